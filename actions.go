@@ -4,6 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/ghodss/yaml"
@@ -22,13 +28,11 @@ func PipelineExecAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 		appName := cc.Args().Get(0)
 		pipelineName := cc.Args().Get(1)
 		monitor := cc.Bool("monitor")
-		numRetries := cc.Int("retry")
 
 		logrus.WithFields(logrus.Fields{
 			"app":      appName,
 			"pipeline": pipelineName,
 			"monitor":  monitor,
-			"retries":  numRetries,
 		}).Info("Executing Pipeline...")
 
 		client, err := clientFromContext(cc, clientConfig)
@@ -36,31 +40,144 @@ func PipelineExecAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 			return errors.Wrapf(err, "creating spinnaker client")
 		}
 
-		resp, err := client.ExecPipeline(appName, pipelineName)
+		reports, err := parseReports(cc.StringSlice("report"))
+		if err != nil {
+			return err
+		}
+
+		params, err := parseParameters(cc.String("params-file"), cc.StringSlice("param"))
+		if err != nil {
+			return errors.Wrap(err, "reading pipeline parameters")
+		}
+		artifacts, err := parseArtifacts(cc.StringSlice("artifact"))
+		if err != nil {
+			return errors.Wrap(err, "reading pipeline artifacts")
+		}
+
+		pipelineConfig, err := client.GetPipelineConfig(appName, pipelineName)
+		if err != nil {
+			return errors.Wrap(err, "fetching pipeline config")
+		}
+		if pipelineConfig == nil {
+			return notFound("could not find pipeline %s in application %s", pipelineName, appName)
+		}
+		if err := validateParameters(*pipelineConfig, params); err != nil {
+			return err
+		}
+
+		resp, err := client.ExecPipeline(appName, pipelineName, spinnaker.ExecutionTrigger{
+			Type:       "manual",
+			User:       cc.String("user"),
+			Parameters: params,
+			Artifacts:  artifacts,
+		})
 		if err != nil {
 			return errors.Wrapf(err, "couldn't execute pipeline")
 		}
 		logrus.Infof("Ref task id: %s", resp.Ref)
 		if monitor {
-			var err error
-			var execResp *spinnaker.ExecutionResponse
-			for retryCounter := 0; retryCounter <= numRetries; {
-				retryCounter++
-				logrus.Infof("Polling tasks status, retry number: %d", retryCounter)
-				execResp, err = client.PollTaskStatus(resp.Ref, 30*time.Minute)
-				if err != nil {
-					logrus.WithField("exec_response", execResp).Errorf("Executing response error: %v", err)
-				}
-			}
-			if err != nil {
-				return err
-			}
-			if execResp != nil && execResp.Status != "SUCCEEDED" {
-				return fmt.Errorf("pipeline did not complete with a SUCCESS status.  Ended with status: %s", execResp.Status)
-			}
+			return monitorExecution(cc, client, executionIDFromRef(resp.Ref), true, reports)
+		}
+		return nil
+	}
+}
+
+// monitorExecution blocks until the execution completes and returns an error
+// unless it succeeded. When offerCancel is set, interrupting the monitor
+// offers to cancel the execution. Reports are written for the last observed
+// state of the execution, even if monitoring failed.
+func monitorExecution(cc *cli.Context, client spinnaker.Client, executionID string, offerCancel bool, reports []reportTarget) error {
+	type pollResult struct {
+		execution *spinnaker.PipelineExecution
+		err       error
+	}
+	stop := make(chan struct{})
+	done := make(chan pollResult, 1)
+	go func() {
+		execution, err := newExecutionMonitor(cc, client, executionID).run(stop)
+		done <- pollResult{execution, err}
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	if offerCancel {
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
+	}
+
+	var result pollResult
+	select {
+	case result = <-done:
+	case <-interrupt:
+		signal.Stop(interrupt)
+		// Wait for the monitor to stop rendering before prompting, so the
+		// progress display does not overwrite the question.
+		close(stop)
+		result = <-done
+	}
+
+	var reportErr error
+	if result.execution != nil {
+		reportErr = writeReports(reports, *result.execution)
+	}
+	if result.err == errMonitorStopped {
+		if reportErr != nil {
+			logrus.WithError(reportErr).Error("Could not write reports")
 		}
+		return cancelInterruptedExecution(client, executionID)
+	}
+	if reportErr != nil {
+		return reportErr
+	}
+	if result.err != nil {
+		return result.err
+	}
+	return executionResult(*result.execution)
+}
+
+// executionResult returns an error unless the execution succeeded.
+func executionResult(execution spinnaker.PipelineExecution) error {
+	if execution.Status != "SUCCEEDED" {
+		return &ExecutionStatusError{ID: execution.ID, Status: execution.Status}
+	}
+	return nil
+}
+
+// taskResult logs the outcome of a completed task and returns an error unless
+// it succeeded.
+func taskResult(resp *spinnaker.ExecutionResponse) error {
+	if resp.Status == "SUCCEEDED" {
+		logrus.WithField("status", resp.Status).Info("Task completed")
 		return nil
 	}
+
+	logrus.WithField("status", resp.Status).Error("Task failed")
+	if retrofitErr := resp.ExtractRetrofitError(); retrofitErr != nil {
+		prettyPrintJSON([]byte(retrofitErr.ResponseBody))
+	} else {
+		logrus.Debugf("Response data %#v", resp)
+	}
+	return &ExecutionStatusError{ID: resp.ID, Status: resp.Status}
+}
+
+// cancelInterruptedExecution offers to cancel an execution whose monitor was
+// interrupted by the user. Declining leaves the execution running.
+func cancelInterruptedExecution(client spinnaker.Client, executionID string) error {
+	fmt.Fprintln(os.Stderr)
+	if !confirm(fmt.Sprintf("Monitoring interrupted, cancel execution %s?", executionID)) {
+		return fmt.Errorf("monitoring interrupted, execution %s is still running", executionID)
+	}
+
+	logrus.WithField("executionId", executionID).Info("Canceling execution")
+	if err := client.CancelPipelineExecution(executionID, "Interrupted from roer"); err != nil {
+		return errors.Wrap(err, "canceling execution")
+	}
+	return &ExecutionStatusError{ID: executionID, Status: "CANCELED"}
+}
+
+// executionIDFromRef extracts the execution ID from a task ref such as
+// /pipelines/01CBHZ2VJ0XMNPJ3Y0Z4A8E6ZT.
+func executionIDFromRef(ref string) string {
+	return path.Base(ref)
 }
 
 // PipelineSaveAction creates the ActionFunc for saving pipeline configurations.
@@ -155,18 +272,7 @@ func AppCreateAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 			return errors.Wrap(err, "poll create app status")
 		}
 
-		if resp.Status == "TERMINAL" {
-			logrus.WithField("status", resp.Status).Error("Task failed")
-			if retrofitErr := resp.ExtractRetrofitError(); retrofitErr != nil {
-				prettyPrintJSON([]byte(retrofitErr.ResponseBody))
-			} else {
-				logrus.Debugf("Response data %#v", resp)
-			}
-		} else {
-			logrus.WithField("status", resp.Status).Info("Task completed")
-		}
-
-		return nil
+		return taskResult(resp)
 	}
 }
 
@@ -206,18 +312,7 @@ func AppDeleteAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 			return errors.Wrap(err, "poll delete app status")
 		}
 
-		if resp.Status == "TERMINAL" {
-			logrus.WithField("status", resp.Status).Error("Task failed")
-			if retrofitErr := resp.ExtractRetrofitError(); retrofitErr != nil {
-				prettyPrintJSON([]byte(retrofitErr.ResponseBody))
-			} else {
-				fmt.Printf("%#v\n", resp)
-			}
-		} else {
-			logrus.WithField("status", resp.Status).Info("Task completed")
-		}
-
-		return nil
+		return taskResult(resp)
 	}
 }
 
@@ -239,7 +334,7 @@ func AppGetAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 
 		if exists == false {
 			logrus.Error("App does not exist or insufficient permission")
-			return fmt.Errorf("Could not fetch app info")
+			return notFound("Could not fetch app info")
 		}
 		appYaml, err := yaml.JSONToYAML(appInfo)
 		if err != nil {
@@ -273,6 +368,106 @@ func AppListAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 	}
 }
 
+// AppBackupAction creates the ActionFunc for backing up applications, their
+// pipelines, strategies and pipeline templates to an archive.
+func AppBackupAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		out := cc.String("out")
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		set, err := fetchAppBackup(client, cc.Args())
+		if err != nil {
+			return err
+		}
+		if err := writeAppBackup(out, set); err != nil {
+			return err
+		}
+
+		pipelines, strategies := 0, 0
+		for _, a := range set.apps {
+			pipelines += len(a.pipelines)
+			strategies += len(a.strategies)
+		}
+		fmt.Printf("Backed up %d applications, %d pipelines, %d strategies and %d templates to %s\n",
+			len(set.apps), pipelines, strategies, len(set.templates), out)
+		return nil
+	}
+}
+
+// AppRestoreAction creates the ActionFunc for restoring a backup archive.
+func AppRestoreAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		archive := cc.Args().Get(0)
+
+		remap, err := parseRemap(cc.StringSlice("remap"))
+		if err != nil {
+			return err
+		}
+		manifest, set, err := readAppBackup(archive)
+		if err != nil {
+			return err
+		}
+		logrus.WithFields(logrus.Fields{
+			"archive":   archive,
+			"createdAt": manifest.CreatedAt,
+		}).Info("Restoring backup")
+		for old := range remap {
+			found := false
+			for _, a := range set.apps {
+				found = found || a.name == old
+			}
+			if !found {
+				return fmt.Errorf("backup %s has no application %s to remap", archive, old)
+			}
+		}
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+		return restoreAppBackup(cc, client, set, remap)
+	}
+}
+
+// MigratePreflightAction creates the ActionFunc for reporting the references
+// of applications that cannot be resolved in the target Spinnaker.
+func MigratePreflightAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		m, err := prepareMigration(cc, clientConfig)
+		if err != nil {
+			return err
+		}
+		printMigrationProblems(m.problems)
+		if len(m.problems) > 0 {
+			return fmt.Errorf("%d references cannot be resolved in the target", len(m.problems))
+		}
+		return nil
+	}
+}
+
+// MigrateAppAction creates the ActionFunc for copying applications, their
+// pipelines, strategies and templates to the target Spinnaker.
+func MigrateAppAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		m, err := prepareMigration(cc, clientConfig)
+		if err != nil {
+			return err
+		}
+		printMigrationProblems(m.problems)
+		if len(m.problems) > 0 {
+			if !cc.Bool("force") {
+				return fmt.Errorf("%d references cannot be resolved in the target, fix the rules or migrate with --force", len(m.problems))
+			}
+			logrus.Warn("Migrating despite unresolved references")
+		}
+		return restoreAppBackup(cc, m.target, m.set, m.rules.Applications)
+	}
+}
+
 // PipelineSaveJSONAction creates the ActionFunc for saving a pipeline from json source
 func PipelineSaveJSONAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 	return func(cc *cli.Context) error {
@@ -310,6 +505,111 @@ func PipelineSaveJSONAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc
 	}
 }
 
+// PipelineSyncAction creates the ActionFunc for syncing a directory of
+// pipelines into an application.
+func PipelineSyncAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		dir := cc.Args().Get(0)
+		if dir == "" {
+			dir = "."
+		}
+		app := cc.String("app")
+
+		local, err := readPipelineDir(dir, app)
+		if err != nil {
+			return errors.Wrapf(err, "reading pipelines in %s", dir)
+		}
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		logrus.WithField("app", app).Info("Comparing pipelines")
+		plan, err := planPipelineSync(client, app, local, cc.Bool("prune"))
+		if err != nil {
+			return err
+		}
+		printSyncPlan(plan)
+		if cc.Bool("dry-run") {
+			return nil
+		}
+		return applyPipelineSync(client, app, plan)
+	}
+}
+
+// PipelineExportAction creates the ActionFunc for exporting the pipelines of
+// an application to files.
+func PipelineExportAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		app := cc.Args().Get(0)
+		outDir := cc.String("out-dir")
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		logrus.WithField("app", app).Info("Fetching pipelines")
+		pipelines, err := client.ListPipelineConfigMaps(app)
+		if err != nil {
+			return errors.Wrap(err, "fetching pipelines")
+		}
+
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return errors.Wrapf(err, "creating %s", outDir)
+		}
+		return exportPipelines(pipelines, outDir, cc.String("output"), cc.Bool("strip-volatile"))
+	}
+}
+
+// PipelineDiffAction creates the ActionFunc for comparing a local pipeline
+// with the pipeline of the same application and name in Spinnaker.
+func PipelineDiffAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		file := cc.Args().Get(0)
+
+		pipeline, config, ok, err := readPipelineFile(file)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s does not hold a pipeline or pipeline template configuration", file)
+		}
+		if cc.String("app") != "" {
+			pipeline["application"] = cc.String("app")
+		}
+		app, name := pipelineField(pipeline, "application"), pipelineField(pipeline, "name")
+		if app == "" || name == "" {
+			return fmt.Errorf("pipeline in %s needs an application and a name", file)
+		}
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"app":      app,
+			"pipeline": name,
+		}).Info("Comparing pipeline")
+		changes, exists, err := pipelineDrift(cc, client, file, pipeline, config)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			fmt.Printf("Pipeline %s/%s does not exist in Spinnaker\n", app, name)
+			return errors.Wrapf(errDriftDetected, "pipeline %s/%s", app, name)
+		}
+		if len(changes) == 0 {
+			fmt.Printf("No drift: %s/%s matches %s\n", app, name, file)
+			return nil
+		}
+		printPipelineDrift(app, name, file, changes)
+		return errors.Wrapf(errDriftDetected, "pipeline %s/%s differs from %s", app, name, file)
+	}
+}
+
 // PipelineListConfigsAction creates the ActionFunc for listing pipeline configs
 func PipelineListConfigsAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 	return func(cc *cli.Context) error {
@@ -356,69 +656,43 @@ func PipelineGetConfigAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc
 	}
 }
 
-// PipelineTemplatePublishAction creates the ActionFunc for publishing pipeline
-// templates.
-func PipelineTemplatePublishAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+// PipelineExecutionsListAction creates the ActionFunc for listing the recent
+// executions of an application, optionally limited to a single pipeline.
+func PipelineExecutionsListAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 	return func(cc *cli.Context) error {
-		if cc.Bool("update") {
-			logrus.Warn("The `update` flag is deprecated, `publish` always creates or updates the template")
-		}
-		templateFile := cc.Args().Get(0)
-		logrus.WithField("file", templateFile).Debug("Reading template")
-
-		template, err := readYamlFile(templateFile)
-		if err != nil {
-			return errors.Wrapf(err, "reading template file: %s", templateFile)
-		}
+		appName := cc.Args().Get(0)
+		pipelineName := cc.Args().Get(1)
+		logrus.WithField("app", appName).WithField("pipelineName", pipelineName).Debug("Fetching executions")
 
 		client, err := clientFromContext(cc, clientConfig)
 		if err != nil {
 			return errors.Wrapf(err, "creating spinnaker client")
 		}
 
-		logrus.Info("Publishing template")
-		ref, err := client.PublishTemplate(template, spinnaker.PublishTemplateOptions{
-			SkipPlan:   cc.Bool("skipPlan"),
-			TemplateID: cc.String("templateId"),
-			Source:     cc.String("source"),
+		executions, err := client.ListPipelineExecutions(appName, spinnaker.ListExecutionsOptions{
+			PipelineName: pipelineName,
+			Statuses:     cc.StringSlice("status"),
+			Limit:        cc.Int("limit"),
 		})
 		if err != nil {
-			return errors.Wrap(err, "publishing template")
-		}
-
-		resp, err := client.PollTaskStatus(ref.Ref, time.Duration(cc.GlobalInt("timeout"))*time.Second)
-		if err != nil {
-			return errors.Wrap(err, "polling task status")
-		}
-
-		if resp.Status == "TERMINAL" {
-			logrus.WithField("status", resp.Status).Error("Task failed")
-			if retrofitErr := resp.ExtractRetrofitError(); retrofitErr != nil {
-				prettyPrintJSON([]byte(retrofitErr.ResponseBody))
-			} else {
-				logrus.Debugf("Response data %#v", resp)
-			}
-		} else {
-			logrus.WithField("status", resp.Status).Info("Task completed")
+			return errors.Wrap(err, "Fetching executions")
 		}
 
+		printExecutionList(executions)
 		return nil
 	}
 }
 
-// PipelineTemplatePlanAction creates the ActionFunc for planning a pipeline
-// template with a given configuration.
-func PipelineTemplatePlanAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+// PipelineExecutionsGetAction creates the ActionFunc for fetching a single
+// pipeline execution
+func PipelineExecutionsGetAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 	return func(cc *cli.Context) error {
-		configFile := cc.Args().Get(0)
-
-		logrus.WithField("file", configFile).Debug("Reading config")
-		config, err := readYamlFile(configFile)
+		executionID := cc.Args().Get(0)
+		logrus.WithField("executionId", executionID).Debug("Fetching execution")
 
-		var template map[string]interface{}
-		if cc.IsSet("template") {
-			logrus.WithField("file", cc.String("template")).Debug("Reading template")
-			template, err = readYamlFile(cc.String("template"))
+		reports, err := parseReports(cc.StringSlice("report"))
+		if err != nil {
+			return err
 		}
 
 		client, err := clientFromContext(cc, clientConfig)
@@ -426,114 +700,800 @@ func PipelineTemplatePlanAction(clientConfig spinnaker.ClientConfig) cli.ActionF
 			return errors.Wrapf(err, "creating spinnaker client")
 		}
 
-		resp, err := client.Plan(config, template)
+		execution, err := client.GetPipelineExecution(executionID)
 		if err != nil {
-			if err == spinnaker.ErrInvalidPipelineTemplate {
-				prettyPrintJSON(resp)
-				return nil
-			}
-			logrus.Info(string(resp))
-			return errors.Wrap(err, "planning configuration")
+			return errors.Wrap(err, "Fetching execution")
+		}
+		if execution == nil {
+			return notFound("could not find execution %s", executionID)
 		}
 
-		prettyPrintJSON(resp)
-		return nil
+		jsonStr, _ := json.Marshal(execution)
+		prettyPrintJSON(jsonStr)
+		return writeReports(reports, *execution)
 	}
 }
 
-// PipelineTemplateConvertAction creates the ActionFunc for converting an existing pipeline
-// into a pipeline template
-func PipelineTemplateConvertAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+// PipelineExecutionsWatchAction creates the ActionFunc for attaching to an
+// existing pipeline execution and waiting for it to complete
+func PipelineExecutionsWatchAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 	return func(cc *cli.Context) error {
-		app := cc.Args().Get(0)
-		pipelineConfigID := cc.Args().Get(1)
+		executionID := cc.Args().Get(0)
 
 		client, err := clientFromContext(cc, clientConfig)
 		if err != nil {
 			return errors.Wrap(err, "creating spinnaker client")
 		}
 
-		resp, err := client.GetPipelineConfig(app, pipelineConfigID)
-		if err != nil {
-			logrus.Debug(resp)
-			return errors.Wrap(err, "getting pipeline config")
-		}
-
-		if resp == nil {
-			logrus.Error("could not find pipeline config")
-		}
-
-		// TODO rz - Write custom marshaler to preserve key order
-		template, err := yaml.Marshal(convertPipelineToTemplate(*resp))
+		reports, err := parseReports(cc.StringSlice("report"))
 		if err != nil {
-			return errors.Wrap(err, "marshaling template to YAML")
+			return err
 		}
 
-		logrus.Info(generatedTemplateHeader)
-		logrus.Info(string(template))
-
-		return nil
+		return monitorExecution(cc, client, executionID, false, reports)
 	}
 }
 
-// PipelineTemplateDeleteAction creates the ActionFunc for deleting a pipeline template
-func PipelineTemplateDeleteAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+// PipelineExecutionsJudgeAction creates the ActionFunc for continuing or
+// stopping a pipeline execution waiting at a manual judgment stage
+func PipelineExecutionsJudgeAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 	return func(cc *cli.Context) error {
-		pipelineTemplateID := cc.Args().Get(0)
+		executionID := cc.Args().Get(0)
 
 		client, err := clientFromContext(cc, clientConfig)
 		if err != nil {
 			return errors.Wrap(err, "creating spinnaker client")
 		}
 
-		logrus.Info("Deleting template")
-		ref, err := client.DeleteTemplate(pipelineTemplateID)
+		execution, err := client.GetPipelineExecution(executionID)
 		if err != nil {
-			return errors.Wrap(err, "deleting pipeline template")
+			return errors.Wrap(err, "fetching execution")
+		}
+		if execution == nil {
+			return notFound("could not find execution %s", executionID)
 		}
 
-		resp, err := client.PollTaskStatus(ref.Ref, time.Duration(cc.GlobalInt("timeout"))*time.Second)
+		stage, err := findStage(*execution, cc.String("stage"))
 		if err != nil {
-			return errors.Wrap(err, "polling task status")
+			return err
 		}
-
-		if resp.Status == "TERMINAL" {
-			logrus.WithField("status", resp.Status).Error("Task failed")
-			if retrofitErr := resp.ExtractRetrofitError(); retrofitErr != nil {
-				prettyPrintJSON([]byte(retrofitErr.ResponseBody))
-			} else {
-				logrus.Debugf("Response data %#v", resp)
+		if stage.Type != "manualJudgment" {
+			return fmt.Errorf("stage %s is a %s stage, not a manualJudgment stage", stage.Name, stage.Type)
+		}
+		if stage.Status != "RUNNING" {
+			return fmt.Errorf("stage %s is not waiting for judgment, status: %s", stage.Name, stage.Status)
+		}
+		if input := cc.String("input"); input != "" {
+			if err := validateJudgmentInput(*stage, input); err != nil {
+				return err
 			}
-		} else {
-			logrus.WithField("status", resp.Status).Info("Task completed")
+		}
+
+		judgment := spinnaker.ManualJudgment{
+			JudgmentStatus:  "continue",
+			JudgmentInput:   cc.String("input"),
+			JudgmentMessage: cc.String("message"),
+		}
+		if cc.Bool("stop") {
+			judgment.JudgmentStatus = "stop"
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"executionId": executionID,
+			"stage":       stage.Name,
+			"judgment":    judgment.JudgmentStatus,
+		}).Info("Judging stage")
+		if err := client.JudgeStage(executionID, stage.ID, judgment); err != nil {
+			return errors.Wrap(err, "judging stage")
 		}
 
 		return nil
 	}
 }
 
-// PipelineDeleteAction creates the ActionFunc for deleting a pipeline
-func PipelineDeleteAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+// PipelineExecutionsRestartAction creates the ActionFunc for restarting a
+// stage of a failed pipeline execution, optionally monitoring the execution
+// afterwards
+func PipelineExecutionsRestartAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
 	return func(cc *cli.Context) error {
-		app := cc.Args().Get(0)
-		pipelineID := cc.Args().Get(1)
+		executionID := cc.Args().Get(0)
+
+		reports, err := parseReports(cc.StringSlice("report"))
+		if err != nil {
+			return err
+		}
 
 		client, err := clientFromContext(cc, clientConfig)
 		if err != nil {
 			return errors.Wrap(err, "creating spinnaker client")
 		}
 
-		logrus.Info("Deleting pipeline")
-		err = client.DeletePipeline(app, pipelineID)
+		execution, err := client.GetPipelineExecution(executionID)
 		if err != nil {
-			return errors.Wrap(err, "deleting pipeline template")
+			return errors.Wrap(err, "fetching execution")
+		}
+		if execution == nil {
+			return notFound("could not find execution %s", executionID)
 		}
 
-		return nil
-	}
+		stage, err := findStage(*execution, cc.String("stage"))
+		if err != nil {
+			return err
+		}
+		switch stage.Status {
+		case "NOT_STARTED", "RUNNING":
+			return fmt.Errorf("stage %s cannot be restarted, status: %s", stage.Name, stage.Status)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"executionId": executionID,
+			"stage":       stage.Name,
+		}).Info("Restarting stage")
+		if err := client.RestartStage(executionID, stage.ID); err != nil {
+			return errors.Wrap(err, "restarting stage")
+		}
+
+		if cc.Bool("monitor") {
+			if err := waitForRestart(client, executionID); err != nil {
+				return err
+			}
+			return monitorExecution(cc, client, executionID, true, reports)
+		}
+		return nil
+	}
+}
+
+// waitForRestart waits for a restarted execution to leave its completed state,
+// as Orca restarts stages asynchronously and a monitor started right away
+// would see the execution as it was before the restart.
+func waitForRestart(client spinnaker.Client, executionID string) error {
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		execution, err := client.GetPipelineExecution(executionID)
+		if err != nil {
+			return errors.Wrap(err, "fetching execution")
+		}
+		if execution != nil && !execution.Complete() {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	logrus.WithField("executionId", executionID).Warn("Execution has not restarted yet")
+	return nil
+}
+
+// PipelineExecutionsCancelAction creates the ActionFunc for canceling a
+// running pipeline execution
+func PipelineExecutionsCancelAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		executionID := cc.Args().Get(0)
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		logrus.WithField("executionId", executionID).Info("Canceling execution")
+		if err := client.CancelPipelineExecution(executionID, cc.String("reason")); err != nil {
+			return errors.Wrap(err, "canceling execution")
+		}
+
+		return nil
+	}
+}
+
+// PipelineExecutionsPauseAction creates the ActionFunc for pausing a running
+// pipeline execution
+func PipelineExecutionsPauseAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		executionID := cc.Args().Get(0)
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		logrus.WithField("executionId", executionID).Info("Pausing execution")
+		if err := client.PausePipelineExecution(executionID); err != nil {
+			return errors.Wrap(err, "pausing execution")
+		}
+
+		return nil
+	}
+}
+
+// PipelineExecutionsResumeAction creates the ActionFunc for resuming a paused
+// pipeline execution
+func PipelineExecutionsResumeAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		executionID := cc.Args().Get(0)
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		logrus.WithField("executionId", executionID).Info("Resuming execution")
+		if err := client.ResumePipelineExecution(executionID); err != nil {
+			return errors.Wrap(err, "resuming execution")
+		}
+
+		return nil
+	}
+}
+
+// PipelineTemplatePublishAction creates the ActionFunc for publishing pipeline
+// templates.
+func PipelineTemplatePublishAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		if cc.Bool("update") {
+			logrus.Warn("The `update` flag is deprecated, `publish` always creates or updates the template")
+		}
+		files, err := expandTemplateFiles(cc.Args())
+		if err != nil {
+			return err
+		}
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrapf(err, "creating spinnaker client")
+		}
+
+		if len(files) == 1 {
+			return publishTemplateFile(cc, client, files[0])
+		}
+		if cc.String("templateId") != "" || cc.String("source") != "" {
+			return errors.New("--templateId and --source can only be used when publishing a single template")
+		}
+		batch, err := orderTemplateFiles(files)
+		if err != nil {
+			return err
+		}
+		return publishTemplateBatch(cc, client, batch)
+	}
+}
+
+// publishTemplateFile publishes the template in a file, after planning its
+// dependent pipelines against it, and waits for the publish task.
+func publishTemplateFile(cc *cli.Context, client spinnaker.Client, templateFile string) error {
+	template, err := readPublishTemplate(cc, templateFile)
+	if err != nil {
+		return err
+	}
+	return publishTemplate(cc, client, newTemplateResolver(nil, client), template)
+}
+
+// publishTemplate publishes a template, after planning its dependent pipelines
+// against it, and waits for the publish task. Dependents are planned with the
+// template sources the resolver substitutes.
+func publishTemplate(cc *cli.Context, client spinnaker.Client, resolver *templateResolver, template map[string]interface{}) error {
+	if cc.Bool("preview") {
+		logrus.Info("Planning dependent pipelines")
+		previews, err := previewDependents(client, resolver, template, true)
+		if err != nil {
+			return errors.Wrap(err, "previewing dependent pipelines")
+		}
+		printPreview(previews)
+		if n := unverifiedDependents(previews); n > 0 {
+			logrus.WithField("count", n).Warn("Dependent pipelines could not be planned")
+		}
+		if n := brokenDependents(previews); n > 0 {
+			return errors.Wrapf(spinnaker.ErrInvalidPipelineTemplate, "%d dependent pipelines fail to plan", n)
+		}
+		return nil
+	}
+
+	skipPlan := cc.Bool("skipPlan")
+	if !skipPlan {
+		logrus.Info("Planning dependent pipelines")
+		previews, err := previewDependents(client, resolver, template, false)
+		if err != nil {
+			return errors.Wrap(err, "planning dependent pipelines")
+		}
+		if err := confirmDependents(previews); err != nil {
+			return err
+		}
+		// Spinnaker would refuse the publish if dependents fail to plan.
+		skipPlan = brokenDependents(previews) > 0
+	}
+
+	logrus.Info("Publishing template")
+	ref, err := client.PublishTemplate(template, spinnaker.PublishTemplateOptions{
+		SkipPlan:   skipPlan,
+		TemplateID: cc.String("templateId"),
+		Source:     cc.String("source"),
+	})
+	if err != nil {
+		return errors.Wrap(err, "publishing template")
+	}
+
+	resp, err := client.PollTaskStatus(ref.Ref, time.Duration(cc.GlobalInt("timeout"))*time.Second)
+	if err != nil {
+		return errors.Wrap(err, "polling task status")
+	}
+
+	return taskResult(resp)
+}
+
+// readPublishTemplate reads a template file as it will be published, with the
+// --templateId and --source overrides applied and a local parent referred to
+// by its template id.
+func readPublishTemplate(cc *cli.Context, templateFile string) (map[string]interface{}, error) {
+	logrus.WithField("file", templateFile).Debug("Reading template")
+	template, err := readYamlFile(templateFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading template file: %s", templateFile)
+	}
+
+	// Apply the overrides up front, so dependents are planned against the
+	// template as it will be published.
+	if id := cc.String("templateId"); id != "" {
+		template["id"] = id
+	}
+	if source := cc.String("source"); source != "" {
+		template["source"] = source
+	}
+
+	// Spinnaker can only resolve published parents, so a local parent is
+	// referred to by its template id. It must be published first.
+	if source, _ := template["source"].(string); isLocalSource(source) {
+		resolver := newTemplateResolver(nil, nil)
+		parent, location, err := resolver.load(source, filepath.Dir(templateFile))
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving source %s", source)
+		}
+		parentID, _ := parent["id"].(string)
+		if parentID == "" {
+			return nil, fmt.Errorf("source template %s has no id", location)
+		}
+		template["source"] = "spinnaker://" + parentID
+		logrus.WithFields(logrus.Fields{
+			"file":   location,
+			"source": template["source"],
+		}).Info("Publishing with the parent template as a published source")
+	}
+	return template, nil
+}
+
+// PipelineTemplateListAction creates the ActionFunc for listing pipeline
+// templates
+func PipelineTemplateListAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		raw, err := client.ListTemplates(cc.StringSlice("scope"))
+		if err != nil {
+			return errors.Wrap(err, "fetching pipeline templates")
+		}
+
+		owner := cc.String("owner")
+		templates := []PipelineTemplate{}
+		for _, r := range raw {
+			var t PipelineTemplate
+			if err := convertMap(r, &t); err != nil {
+				return errors.Wrapf(err, "decoding pipeline template %v", r["id"])
+			}
+			if owner != "" && !strings.EqualFold(t.Metadata.Owner, owner) {
+				continue
+			}
+			templates = append(templates, t)
+		}
+		sort.Slice(templates, func(i, j int) bool {
+			return templates[i].ID < templates[j].ID
+		})
+
+		printTemplateList(templates)
+		return nil
+	}
+}
+
+// PipelineTemplateGetAction creates the ActionFunc for fetching a pipeline
+// template, which can be edited and published again.
+func PipelineTemplateGetAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		templateID := cc.Args().Get(0)
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		template, err := client.GetTemplate(templateID)
+		if err != nil {
+			return errors.Wrap(err, "fetching pipeline template")
+		}
+		if template == nil {
+			return notFound("could not find pipeline template %s", templateID)
+		}
+
+		dat, err := marshalOutput(template, cc.String("output"))
+		if err != nil {
+			return errors.Wrap(err, "marshaling pipeline template")
+		}
+		return writeOutput(cc.String("out"), dat)
+	}
+}
+
+// PipelineTemplateDependentsAction creates the ActionFunc for listing the
+// pipeline configs that depend on a pipeline template
+func PipelineTemplateDependentsAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		templateID := cc.Args().Get(0)
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		dependents, err := client.ListTemplateDependents(templateID, true)
+		if err != nil {
+			return errors.Wrap(err, "fetching pipeline template dependents")
+		}
+
+		printDependentList(templateID, dependents)
+		return nil
+	}
+}
+
+// PipelineTemplatePlanAction creates the ActionFunc for planning a pipeline
+// template with a given configuration.
+func PipelineTemplatePlanAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		configFile := cc.Args().Get(0)
+
+		logrus.WithField("file", configFile).Debug("Reading config")
+		config, err := readYamlFile(configFile)
+		if err != nil {
+			return errors.Wrapf(err, "reading config file: %s", configFile)
+		}
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrapf(err, "creating spinnaker client")
+		}
+
+		// Templates that resolve locally are inlined, so Orca plans the local
+		// versions instead of the published ones.
+		resolver := newTemplateResolver(cc.StringSlice("template-path"), client)
+		template, templateFile, err := configurationTemplate(resolver, configFile, config, cc.String("template"))
+		if err != nil {
+			return errors.Wrap(err, "resolving pipeline template")
+		}
+
+		// Variables are checked before planning, against the published
+		// template when the template is not local.
+		checked := template
+		if checked == nil {
+			checked = publishedConfigurationTemplate(resolver, config)
+		}
+		if checked != nil {
+			sources := newPlanSources(configFile, templateFile)
+			if err := validateConfigurationVariables(checked, config, sources, cc.String("fail-on")); err != nil {
+				return err
+			}
+		}
+
+		resp, err := client.Plan(config, template)
+		if err != nil {
+			if err == spinnaker.ErrInvalidPipelineTemplate {
+				planErrors, decodeErr := decodePlanErrors(resp)
+				if decodeErr != nil {
+					logrus.WithError(decodeErr).Debug("Could not decode plan errors")
+					prettyPrintJSON(resp)
+					return err
+				}
+				printPlanErrors(planErrors, newPlanSources(configFile, templateFile))
+				if planFailed(planErrors, cc.String("fail-on")) {
+					return err
+				}
+				return nil
+			}
+			logrus.Info(string(resp))
+			return errors.Wrap(err, "planning configuration")
+		}
+
+		prettyPrintJSON(resp)
+		return nil
+	}
+}
+
+// PipelineTemplateRenderAction creates the ActionFunc for rendering a pipeline
+// template configuration to the final pipeline JSON. With --offline the
+// pipeline is rendered locally, otherwise Orca plans it.
+func PipelineTemplateRenderAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		if !cc.Bool("offline") {
+			return PipelineTemplatePlanAction(clientConfig)(cc)
+		}
+
+		configFile := cc.Args().Get(0)
+		logrus.WithField("file", configFile).Debug("Reading config")
+		configMap, err := readYamlFile(configFile)
+		if err != nil {
+			return errors.Wrapf(err, "reading config file: %s", configFile)
+		}
+		var config PipelineConfiguration
+		if err := convertMap(configMap, &config); err != nil {
+			return errors.Wrap(err, "decoding pipeline configuration")
+		}
+
+		resolver := newTemplateResolver(cc.StringSlice("template-path"), nil)
+		templateMap, templateFile, err := configurationTemplate(resolver, configFile, configMap, cc.String("template"))
+		if err != nil {
+			return errors.Wrap(err, "resolving pipeline template")
+		}
+		if templateMap == nil {
+			return fmt.Errorf("rendering offline requires a local template: use --template, a local template source or --template-path, got %q", config.Pipeline.Template.Source)
+		}
+		var template PipelineTemplate
+		if err := convertMap(templateMap, &template); err != nil {
+			return errors.Wrap(err, "decoding pipeline template")
+		}
+		if err := reportPlanErrors(checkPipelineTemplate(template, config), newPlanSources(configFile, templateFile), "fatal"); err != nil {
+			return err
+		}
+
+		pipeline, err := renderPipeline(config, template)
+		if invalid, ok := err.(*templateInvalidError); ok {
+			printPlanErrors(invalid.resp, newPlanSources(configFile, templateFile))
+			return spinnaker.ErrInvalidPipelineTemplate
+		}
+		if err != nil {
+			return errors.Wrap(spinnaker.ErrInvalidPipelineTemplate, err.Error())
+		}
+
+		dat, err := json.MarshalIndent(pipeline, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "marshaling pipeline")
+		}
+		fmt.Println(string(dat))
+		return nil
+	}
+}
+
+// PipelineTemplateResolveAction creates the ActionFunc for resolving the source
+// chain of a local template and printing the fully merged template.
+func PipelineTemplateResolveAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		var client spinnaker.Client
+		if !cc.Bool("offline") {
+			var err error
+			if client, err = clientFromContext(cc, clientConfig); err != nil {
+				return errors.Wrap(err, "creating spinnaker client")
+			}
+		}
+		resolver := newTemplateResolver(cc.StringSlice("template-path"), client)
+
+		arg := cc.Args().Get(0)
+		var template map[string]interface{}
+		var location string
+		var err error
+		if strings.HasPrefix(arg, "spinnaker://") {
+			template, location, err = resolver.load(arg, "")
+		} else {
+			template, location, err = resolver.loadFile(arg)
+		}
+		if err != nil {
+			return errors.Wrap(err, "loading template")
+		}
+
+		merged, chain, err := resolver.resolve(template, location)
+		if err != nil {
+			return errors.Wrap(err, "resolving template")
+		}
+		for i, l := range chain {
+			logrus.WithField("depth", i).Infof("Resolved %s", l)
+		}
+
+		dat, err := marshalOutput(merged, cc.String("output"))
+		if err != nil {
+			return errors.Wrap(err, "marshaling template")
+		}
+		return writeOutput(cc.String("out"), dat)
+	}
+}
+
+// PipelineTemplateTestAction creates the ActionFunc for running the template
+// test cases in a directory against their golden files.
+func PipelineTemplateTestAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		dir := cc.Args().Get(0)
+		if dir == "" {
+			dir = "."
+		}
+		cases, err := discoverTemplateTests(dir)
+		if err != nil {
+			return errors.Wrapf(err, "discovering template tests in %s", dir)
+		}
+		if len(cases) == 0 {
+			return fmt.Errorf("no template tests (*%s) found in %s", testConfigSuffix, dir)
+		}
+
+		var plan templatePlanner
+		if cc.Bool("offline") {
+			plan = offlinePlanner(newTemplateResolver(cc.StringSlice("template-path"), nil))
+		} else {
+			client, err := clientFromContext(cc, clientConfig)
+			if err != nil {
+				return errors.Wrap(err, "creating spinnaker client")
+			}
+			plan = onlinePlanner(client, newTemplateResolver(cc.StringSlice("template-path"), client))
+		}
+
+		failed := 0
+		for _, c := range cases {
+			logrus.WithField("file", c.configFile).Debug("Running template test")
+			result := runTemplateTest(c, plan, cc.Bool("update"))
+			switch {
+			case result.updated:
+				fmt.Printf("UPDATED %s: %s\n", c.name, result.message)
+			case result.passed:
+				fmt.Printf("PASS    %s\n", c.name)
+			default:
+				failed++
+				fmt.Printf("FAIL    %s: %s\n", c.name, result.message)
+				fmt.Print(result.diff)
+			}
+		}
+
+		fmt.Printf("\n%d passed, %d failed\n", len(cases)-failed, failed)
+		if failed > 0 {
+			return fmt.Errorf("%d of %d template tests failed", failed, len(cases))
+		}
+		return nil
+	}
+}
+
+// PipelineTemplateDocsAction creates the ActionFunc for generating Markdown
+// documentation of local pipeline templates.
+func PipelineTemplateDocsAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		docs := []templateDoc{}
+		pages := map[string]string{}
+		for _, file := range cc.Args() {
+			logrus.WithField("file", file).Debug("Reading template")
+			templateMap, err := readYamlFile(file)
+			if err != nil {
+				return err
+			}
+			var template PipelineTemplate
+			if err := convertMap(templateMap, &template); err != nil {
+				return errors.Wrapf(err, "decoding pipeline template %s", file)
+			}
+			if template.ID == "" {
+				return fmt.Errorf("template %s has no id", file)
+			}
+			if _, ok := pages[template.ID]; ok {
+				return fmt.Errorf("template %s is given more than once", template.ID)
+			}
+			pages[template.ID] = pageName(template)
+			docs = append(docs, templateDoc{template: template, file: pageName(template)})
+		}
+
+		outDir := cc.String("out-dir")
+		if outDir == "" {
+			for i, d := range docs {
+				if i > 0 {
+					fmt.Println()
+				}
+				fmt.Print(renderTemplateDoc(d.template, nil))
+			}
+			return nil
+		}
+
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return errors.Wrapf(err, "creating %s", outDir)
+		}
+		for _, d := range docs {
+			if err := writeOutput(filepath.Join(outDir, d.file), []byte(renderTemplateDoc(d.template, pages))); err != nil {
+				return err
+			}
+		}
+		sortTemplateDocs(docs)
+		return writeOutput(filepath.Join(outDir, "index.md"), []byte(renderTemplateIndex(docs)))
+	}
+}
+
+// PipelineTemplateConvertAction creates the ActionFunc for converting an existing pipeline
+// into a pipeline template
+func PipelineTemplateConvertAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		app := cc.Args().Get(0)
+		pipelineConfigID := cc.Args().Get(1)
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		resp, err := client.GetPipelineConfig(app, pipelineConfigID)
+		if err != nil {
+			logrus.Debug(resp)
+			return errors.Wrap(err, "getting pipeline config")
+		}
+
+		if resp == nil {
+			return notFound("could not find pipeline config %s in application %s", pipelineConfigID, app)
+		}
+
+		// TODO rz - Write custom marshaler to preserve key order
+		template, err := yaml.Marshal(convertPipelineToTemplate(*resp))
+		if err != nil {
+			return errors.Wrap(err, "marshaling template to YAML")
+		}
+
+		logrus.Info(generatedTemplateHeader)
+		logrus.Info(string(template))
+
+		return nil
+	}
+}
+
+// PipelineTemplateDeleteAction creates the ActionFunc for deleting a pipeline template
+func PipelineTemplateDeleteAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		pipelineTemplateID := cc.Args().Get(0)
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		if !cc.Bool("force") {
+			dependents, err := client.ListTemplateDependents(pipelineTemplateID, true)
+			if err != nil {
+				return errors.Wrap(err, "fetching pipeline template dependents")
+			}
+			if len(dependents) > 0 {
+				printDependentList(pipelineTemplateID, dependents)
+				return fmt.Errorf("pipeline template %s still has %d dependent pipelines, use --force to delete it anyway", pipelineTemplateID, len(dependents))
+			}
+		}
+
+		logrus.Info("Deleting template")
+		ref, err := client.DeleteTemplate(pipelineTemplateID)
+		if err != nil {
+			return errors.Wrap(err, "deleting pipeline template")
+		}
+
+		resp, err := client.PollTaskStatus(ref.Ref, time.Duration(cc.GlobalInt("timeout"))*time.Second)
+		if err != nil {
+			return errors.Wrap(err, "polling task status")
+		}
+
+		return taskResult(resp)
+	}
+}
+
+// PipelineDeleteAction creates the ActionFunc for deleting a pipeline
+func PipelineDeleteAction(clientConfig spinnaker.ClientConfig) cli.ActionFunc {
+	return func(cc *cli.Context) error {
+		app := cc.Args().Get(0)
+		pipelineID := cc.Args().Get(1)
+
+		client, err := clientFromContext(cc, clientConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating spinnaker client")
+		}
+
+		logrus.Info("Deleting pipeline")
+		err = client.DeletePipeline(app, pipelineID)
+		if err != nil {
+			return errors.Wrap(err, "deleting pipeline template")
+		}
+
+		return nil
+	}
 }
 
 func clientFromContext(cc *cli.Context, config spinnaker.ClientConfig) (spinnaker.Client, error) {
+	if config.Endpoint == "" {
+		return nil, errors.New("SPINNAKER_API must be set")
+	}
+
 	hc, err := config.HTTPClientFactory(cc)
 	if err != nil {
 		return nil, errors.Wrap(err, "creating http client from context")
@@ -552,6 +1512,44 @@ func clientFromContext(cc *cli.Context, config spinnaker.ClientConfig) (spinnake
 	return sc, nil
 }
 
+// targetClientFromContext creates the client for the target Spinnaker of a
+// migration, configured by the --target-* flags of the command.
+func targetClientFromContext(cc *cli.Context, config spinnaker.ClientConfig) (spinnaker.Client, error) {
+	endpoint := cc.String("target-api")
+	if endpoint == "" {
+		return nil, errors.New("--target-api or SPINNAKER_TARGET_API must be set")
+	}
+	if endpoint == config.Endpoint {
+		return nil, errors.New("the target Spinnaker must differ from SPINNAKER_API")
+	}
+
+	hc, err := config.TargetHTTPClientFactory(cc)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating http client from context")
+	}
+
+	sc := spinnaker.New(endpoint, hc)
+
+	if cc.IsSet("target-fiat-user") && cc.IsSet("target-fiat-pass") {
+		err := sc.FiatLogin(cc.String("target-fiat-user"), cc.String("target-fiat-pass"))
+		if err != nil {
+			return nil, errors.Wrap(err, "target fiat auth login attempt")
+		}
+	}
+
+	return sc, nil
+}
+
+// convertMap converts untyped data, such as a template returned by the API,
+// into one of the typed models.
+func convertMap(m interface{}, v interface{}) error {
+	dat, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(dat, v)
+}
+
 func readYamlFile(f string) (map[string]interface{}, error) {
 	configDat, err := ioutil.ReadFile(f)
 	if err != nil {
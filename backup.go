@@ -0,0 +1,535 @@
+package roer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// backupFormatVersion is the version of the backup archive format. It is
+// raised whenever the layout of the archive changes, and restore refuses
+// archives of a newer version than it knows.
+const backupFormatVersion = 1
+
+const backupManifestFile = "manifest.json"
+
+// defaultRestoreTimeout is how long restore waits for each of its tasks,
+// unless the global --timeout is set.
+const defaultRestoreTimeout = 5 * time.Minute
+
+// backupManifest describes the content of a backup archive.
+type backupManifest struct {
+	FormatVersion int                 `json:"formatVersion"`
+	CreatedAt     string              `json:"createdAt"`
+	Applications  []backupApplication `json:"applications"`
+	// Templates are listed with parents before their children, in the
+	// order they are published on restore.
+	Templates []string `json:"templates"`
+}
+
+type backupApplication struct {
+	Name       string `json:"name"`
+	Pipelines  int    `json:"pipelines"`
+	Strategies int    `json:"strategies"`
+}
+
+// appBackup is an application along with its pipelines and strategies.
+// Configs are kept as generic maps, so no field is lost on the way through.
+type appBackup struct {
+	name       string
+	attributes map[string]interface{}
+	pipelines  []map[string]interface{}
+	strategies []map[string]interface{}
+}
+
+// appBackupSet is the content of a backup archive.
+type appBackupSet struct {
+	apps      []appBackup
+	templates []map[string]interface{}
+}
+
+func appBackupDir(app string) string {
+	return path.Join("applications", app)
+}
+
+func templateBackupFile(id string) string {
+	return path.Join("templates", unsafeFileNameChars.ReplaceAllString(id, "-")+".json")
+}
+
+// fetchAppBackup fetches the applications, their pipelines and strategies,
+// and the pipeline templates the pipelines are planned from.
+func fetchAppBackup(client spinnaker.Client, apps []string) (*appBackupSet, error) {
+	set := &appBackupSet{}
+	templateIDs := []string{}
+	for _, app := range apps {
+		log := logrus.WithField("app", app)
+		log.Info("Fetching application")
+		exists, dat, err := client.ApplicationGet(app)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetching application %s", app)
+		}
+		if !exists {
+			return nil, notFound("application %s does not exist", app)
+		}
+		var info map[string]interface{}
+		if err := json.Unmarshal(dat, &info); err != nil {
+			return nil, errors.Wrapf(err, "unmarshaling application %s", app)
+		}
+		attributes, ok := info["attributes"].(map[string]interface{})
+		if !ok {
+			attributes = info
+		}
+
+		log.Info("Fetching pipelines and strategies")
+		pipelines, err := client.ListPipelineConfigMaps(app)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetching pipelines of %s", app)
+		}
+		strategies, err := client.ListStrategyConfigs(app)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetching strategies of %s", app)
+		}
+
+		for _, p := range pipelines {
+			if id := pipelineTemplateID(p); id != "" {
+				templateIDs = append(templateIDs, id)
+			}
+		}
+		set.apps = append(set.apps, appBackup{
+			name:       app,
+			attributes: attributes,
+			pipelines:  pipelines,
+			strategies: strategies,
+		})
+	}
+
+	templates, err := fetchTemplateChain(client, templateIDs)
+	if err != nil {
+		return nil, err
+	}
+	set.templates = templates
+	return set, nil
+}
+
+// pipelineTemplateID returns the id of the published template a templated
+// pipeline config is planned from, if any.
+func pipelineTemplateID(pipeline map[string]interface{}) string {
+	if pipeline["type"] != "templatedPipeline" {
+		return ""
+	}
+	config, _ := pipeline["config"].(map[string]interface{})
+	source := configurationSource(config)
+	if !strings.HasPrefix(source, "spinnaker://") {
+		return ""
+	}
+	return strings.TrimPrefix(source, "spinnaker://")
+}
+
+// fetchTemplateChain fetches the templates and, recursively, their published
+// parents. Parents come before their children.
+func fetchTemplateChain(client spinnaker.Client, ids []string) ([]map[string]interface{}, error) {
+	templates := []map[string]interface{}{}
+	visited := map[string]bool{}
+	var visit func(id, referrer string) error
+	visit = func(id, referrer string) error {
+		if visited[id] {
+			return nil
+		}
+		visited[id] = true
+
+		logrus.WithField("templateId", id).Info("Fetching pipeline template")
+		template, err := client.GetTemplate(id)
+		if err != nil {
+			return errors.Wrapf(err, "fetching template %s", id)
+		}
+		if template == nil {
+			return notFound("template %s referenced by %s does not exist", id, referrer)
+		}
+		if source, _ := template["source"].(string); strings.HasPrefix(source, "spinnaker://") {
+			if err := visit(strings.TrimPrefix(source, "spinnaker://"), "template "+id); err != nil {
+				return err
+			}
+		}
+		templates = append(templates, template)
+		return nil
+	}
+	for _, id := range ids {
+		if err := visit(id, "a pipeline"); err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// writeAppBackup writes a backup archive: a gzipped tarball holding the
+// manifest, a directory per application and the templates.
+func writeAppBackup(file string, set *appBackupSet) error {
+	manifest := backupManifest{
+		FormatVersion: backupFormatVersion,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		Applications:  []backupApplication{},
+		Templates:     []string{},
+	}
+	for _, a := range set.apps {
+		manifest.Applications = append(manifest.Applications, backupApplication{
+			Name:       a.name,
+			Pipelines:  len(a.pipelines),
+			Strategies: len(a.strategies),
+		})
+	}
+	for _, t := range set.templates {
+		id, _ := t["id"].(string)
+		manifest.Templates = append(manifest.Templates, id)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", file)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	add := func(name string, v interface{}) error {
+		dat, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return errors.Wrapf(err, "marshaling %s", name)
+		}
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(dat)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(dat)
+		return err
+	}
+
+	if err := add(backupManifestFile, manifest); err != nil {
+		return err
+	}
+	for _, a := range set.apps {
+		dir := appBackupDir(a.name)
+		if err := add(path.Join(dir, "application.json"), a.attributes); err != nil {
+			return err
+		}
+		if err := add(path.Join(dir, "pipelines.json"), a.pipelines); err != nil {
+			return err
+		}
+		if err := add(path.Join(dir, "strategies.json"), a.strategies); err != nil {
+			return err
+		}
+	}
+	for i, t := range set.templates {
+		if err := add(templateBackupFile(manifest.Templates[i]), t); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.Wrapf(err, "writing %s", file)
+	}
+	if err := gz.Close(); err != nil {
+		return errors.Wrapf(err, "writing %s", file)
+	}
+	return f.Close()
+}
+
+// readAppBackup reads a backup archive written by writeAppBackup.
+func readAppBackup(file string) (*backupManifest, *appBackupSet, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "%s is not a backup archive", file)
+	}
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "reading %s", file)
+		}
+		dat, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "reading %s from %s", hdr.Name, file)
+		}
+		files[hdr.Name] = dat
+	}
+
+	read := func(name string, v interface{}) error {
+		dat, ok := files[name]
+		if !ok {
+			return fmt.Errorf("backup %s has no %s", file, name)
+		}
+		return errors.Wrapf(json.Unmarshal(dat, v), "unmarshaling %s", name)
+	}
+
+	var manifest backupManifest
+	if err := read(backupManifestFile, &manifest); err != nil {
+		return nil, nil, err
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > backupFormatVersion {
+		return nil, nil, fmt.Errorf("backup %s has format version %d, this version of roer reads up to %d", file, manifest.FormatVersion, backupFormatVersion)
+	}
+
+	set := &appBackupSet{}
+	for _, a := range manifest.Applications {
+		backup := appBackup{name: a.Name}
+		dir := appBackupDir(a.Name)
+		if err := read(path.Join(dir, "application.json"), &backup.attributes); err != nil {
+			return nil, nil, err
+		}
+		if err := read(path.Join(dir, "pipelines.json"), &backup.pipelines); err != nil {
+			return nil, nil, err
+		}
+		if err := read(path.Join(dir, "strategies.json"), &backup.strategies); err != nil {
+			return nil, nil, err
+		}
+		set.apps = append(set.apps, backup)
+	}
+	for _, id := range manifest.Templates {
+		var template map[string]interface{}
+		if err := read(templateBackupFile(id), &template); err != nil {
+			return nil, nil, err
+		}
+		set.templates = append(set.templates, template)
+	}
+	return &manifest, set, nil
+}
+
+// parseRemap parses --remap values of the form old=new into a map of
+// application names.
+func parseRemap(values []string) (map[string]string, error) {
+	remap := map[string]string{}
+	for _, v := range values {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid remap %q, expected old=new", v)
+		}
+		remap[kv[0]] = kv[1]
+	}
+	return remap, nil
+}
+
+// restoreAppBackup restores the templates, applications, pipelines and
+// strategies of a backup. It can be run repeatedly: applications are created
+// or updated, and pipelines and strategies are matched to existing ones by
+// name, so they are updated in place rather than duplicated. Applications
+// are renamed as given by remap.
+func restoreAppBackup(cc *cli.Context, client spinnaker.Client, set *appBackupSet, remap map[string]string) error {
+	timeout := defaultRestoreTimeout
+	if cc.GlobalIsSet("timeout") && cc.GlobalInt("timeout") > 0 {
+		timeout = time.Duration(cc.GlobalInt("timeout")) * time.Second
+	}
+	targetApp := func(app string) string {
+		if target, ok := remap[app]; ok {
+			return target
+		}
+		return app
+	}
+
+	if !cc.Bool("skip-templates") {
+		for _, t := range set.templates {
+			logrus.WithField("templateId", t["id"]).Info("Publishing pipeline template")
+			ref, err := client.PublishTemplate(t, spinnaker.PublishTemplateOptions{SkipPlan: true})
+			if err != nil {
+				return errors.Wrapf(err, "publishing template %v", t["id"])
+			}
+			resp, err := client.PollTaskStatus(ref.Ref, timeout)
+			if err != nil {
+				return errors.Wrap(err, "polling task status")
+			}
+			if err := taskResult(resp); err != nil {
+				return errors.Wrapf(err, "publishing template %v", t["id"])
+			}
+		}
+	}
+
+	// Ids are assigned to every pipeline and strategy up front, so that
+	// references between them, even across applications, can be rewritten
+	// before anything is saved.
+	ids := map[string]string{}
+	for _, a := range set.apps {
+		target := targetApp(a.name)
+		pipelines, err := client.ListPipelineConfigMaps(target)
+		if err != nil {
+			return errors.Wrapf(err, "fetching pipelines of %s", target)
+		}
+		strategies, err := client.ListStrategyConfigs(target)
+		if err != nil {
+			return errors.Wrapf(err, "fetching strategies of %s", target)
+		}
+		if err := assignRestoreIDs(ids, a.pipelines, pipelines, target != a.name); err != nil {
+			return err
+		}
+		if err := assignRestoreIDs(ids, a.strategies, strategies, target != a.name); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range set.apps {
+		target := targetApp(a.name)
+		if err := restoreApplication(client, target, a.attributes, timeout); err != nil {
+			return err
+		}
+		for _, p := range a.pipelines {
+			p = restoredConfig(p, remap, ids)
+			logrus.WithFields(logrus.Fields{"app": target, "pipeline": p["name"]}).Info("Saving pipeline")
+			if err := client.SavePipelineConfigMap(p); err != nil {
+				return errors.Wrapf(err, "saving pipeline %v", p["name"])
+			}
+		}
+		for _, s := range a.strategies {
+			s = restoredConfig(s, remap, ids)
+			logrus.WithFields(logrus.Fields{"app": target, "strategy": s["name"]}).Info("Saving strategy")
+			if err := client.SaveStrategyConfig(s); err != nil {
+				return errors.Wrapf(err, "saving strategy %v", s["name"])
+			}
+		}
+	}
+	return nil
+}
+
+// assignRestoreIDs maps the ids of backed up configs to the ids they are
+// restored with: the id of the existing config of the same name, the backed
+// up id when restoring into the same application, and a new id otherwise, so
+// a renamed copy does not overwrite the original.
+func assignRestoreIDs(ids map[string]string, backedUp, existing []map[string]interface{}, renamed bool) error {
+	byName := map[string]string{}
+	for _, e := range existing {
+		name, _ := e["name"].(string)
+		id, _ := e["id"].(string)
+		byName[name] = id
+	}
+	for _, c := range backedUp {
+		name, _ := c["name"].(string)
+		id, _ := c["id"].(string)
+		if id == "" {
+			continue
+		}
+		switch {
+		case byName[name] != "":
+			ids[id] = byName[name]
+		case !renamed:
+			ids[id] = id
+		default:
+			newID, err := newConfigID()
+			if err != nil {
+				return err
+			}
+			ids[id] = newID
+		}
+	}
+	return nil
+}
+
+// restoredConfig returns a copy of a backed up pipeline or strategy with its
+// restore id, and with application names and pipeline ids referred to by
+// triggers, stages and template configurations rewritten.
+func restoredConfig(config map[string]interface{}, remap, ids map[string]string) map[string]interface{} {
+	var rewrite func(v interface{}) interface{}
+	rewrite = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			m := make(map[string]interface{}, len(v))
+			for k, item := range v {
+				s, isString := item.(string)
+				switch {
+				case isString && k == "application" && remap[s] != "":
+					m[k] = remap[s]
+				case isString && (k == "pipeline" || k == "pipelineConfigId") && s != "" && ids[s] != "":
+					m[k] = ids[s]
+				default:
+					m[k] = rewrite(item)
+				}
+			}
+			return m
+		case []interface{}:
+			l := make([]interface{}, len(v))
+			for i, item := range v {
+				l[i] = rewrite(item)
+			}
+			return l
+		}
+		return v
+	}
+
+	restored := rewrite(config).(map[string]interface{})
+	if id, _ := config["id"].(string); ids[id] != "" {
+		restored["id"] = ids[id]
+	}
+	delete(restored, "updateTs")
+	delete(restored, "lastModifiedBy")
+	return restored
+}
+
+// restoreApplication creates the application, or updates it if it exists.
+func restoreApplication(client spinnaker.Client, app string, attributes map[string]interface{}, timeout time.Duration) error {
+	exists, _, err := client.ApplicationGet(app)
+	if err != nil {
+		return errors.Wrapf(err, "fetching application %s", app)
+	}
+	jobType := "createApplication"
+	if exists {
+		jobType = "updateApplication"
+	}
+
+	application := map[string]interface{}{}
+	for k, v := range attributes {
+		application[k] = v
+	}
+	application["name"] = app
+
+	logrus.WithFields(logrus.Fields{"app": app, "job": jobType}).Info("Restoring application")
+	ref, err := client.ApplicationSubmitTask(app, spinnaker.Task{
+		Application: app,
+		Description: "Restore Application: " + app,
+		Job: []interface{}{spinnaker.ApplicationJob{
+			Application: application,
+			Type:        jobType,
+		}},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "submitting task for application %s", app)
+	}
+	resp, err := client.PollTaskStatus(ref.Ref, timeout)
+	if err != nil {
+		return errors.Wrap(err, "poll restore app status")
+	}
+	return taskResult(resp)
+}
+
+// newConfigID returns a random UUID for a pipeline or strategy.
+func newConfigID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating id")
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -48,6 +48,99 @@ func NewRoer(version string, clientConfig spinnaker.ClientConfig) *cli.App {
 					},
 					Action: roer.PipelineSaveJSONAction(clientConfig),
 				},
+				{
+					Name:  "sync",
+					Usage: "sync a directory of pipelines into an application",
+					Description: `
+		Treats a directory of pipelines, pipeline template
+		configurations in YAML and raw pipelines in JSON, as the
+		source of truth for an application: missing pipelines are
+		created and changed ones updated, matched by name so they
+		keep their ids. With --prune, pipelines that only exist in
+		Spinnaker are deleted.
+					`,
+					ArgsUsage: "[dir]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "app, a",
+							Usage: "application to sync the pipelines into",
+						},
+						cli.BoolFlag{
+							Name:  "prune",
+							Usage: "delete pipelines of the application that are not in the directory",
+						},
+						cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "only print the changes that would be made",
+						},
+					},
+					Before: func(cc *cli.Context) error {
+						if cc.String("app") == "" {
+							return errors.New("--app is required")
+						}
+						if cc.NArg() > 1 {
+							return errors.New("only one pipeline directory may be given")
+						}
+						return nil
+					},
+					Action: roer.PipelineSyncAction(clientConfig),
+				},
+				{
+					Name:  "diff",
+					Usage: "compare a pipeline file with the pipeline in Spinnaker",
+					Description: `
+		Fetches the pipeline with the same application and name as
+		the pipeline in the file and prints what differs, ignoring
+		key order, the fields Spinnaker sets on every save and
+		generated stage ids. Stages are matched by refId. Pipeline
+		template configurations are compared by their planned
+		pipelines. Exits with code 2 when the pipelines differ or
+		the pipeline does not exist in Spinnaker.
+					`,
+					ArgsUsage: "[file]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "app, a",
+							Usage: "application of the pipeline, if not set in the file",
+						},
+						templatePathFlag(),
+					},
+					Before: func(cc *cli.Context) error {
+						if cc.NArg() != 1 {
+							return errors.New("exactly one pipeline file must be given")
+						}
+						return nil
+					},
+					Action: roer.PipelineDiffAction(clientConfig),
+				},
+				{
+					Name:      "export",
+					Usage:     "export every pipeline of an application to files",
+					ArgsUsage: "[application name]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "out-dir",
+							Usage: "directory to write a file per pipeline to",
+							Value: ".",
+						},
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "output format, json or yaml",
+							Value: "json",
+						},
+						cli.BoolFlag{
+							Name:  "strip-volatile",
+							Usage: "leave out ids, updateTs and lastModifiedBy, which change on every save",
+						},
+					},
+					Before: func(cc *cli.Context) error {
+						if cc.NArg() != 1 {
+							return errors.New("name of application is required")
+						}
+						return nil
+					},
+					Action: roer.PipelineExportAction(clientConfig),
+				},
 				{
 					Name:      "list",
 					Usage:     "list all the pipelines in an application",
@@ -84,6 +177,170 @@ func NewRoer(version string, clientConfig spinnaker.ClientConfig) *cli.App {
 					},
 					Action: roer.PipelineDeleteAction(clientConfig),
 				},
+				{
+					Name:  "executions",
+					Usage: "pipeline execution tasks",
+					Subcommands: []cli.Command{
+						{
+							Name:      "list",
+							Usage:     "list the recent executions of an application or pipeline",
+							ArgsUsage: "[application name] [pipeline name]",
+							Flags: []cli.Flag{
+								cli.StringSliceFlag{
+									Name:  "status, s",
+									Usage: "only list executions with the given status, may be repeated",
+								},
+								cli.IntFlag{
+									Name:  "limit, l",
+									Usage: "maximum number of executions to list",
+									Value: 25,
+								},
+							},
+							Before: func(cc *cli.Context) error {
+								if cc.NArg() < 1 || cc.NArg() > 2 {
+									return errors.New("name of application is required")
+								}
+								return nil
+							},
+							Action: roer.PipelineExecutionsListAction(clientConfig),
+						},
+						{
+							Name:      "get",
+							Usage:     "get a single pipeline execution",
+							ArgsUsage: "[executionId]",
+							Flags: []cli.Flag{
+								reportFlag(),
+							},
+							Before: func(cc *cli.Context) error {
+								if cc.NArg() != 1 {
+									return errors.New("execution id is required")
+								}
+								return nil
+							},
+							Action: roer.PipelineExecutionsGetAction(clientConfig),
+						},
+						{
+							Name:      "watch",
+							Usage:     "wait for an existing pipeline execution to complete",
+							ArgsUsage: "[executionId]",
+							Flags:     monitorFlags(),
+							Before: func(cc *cli.Context) error {
+								if cc.NArg() != 1 {
+									return errors.New("execution id is required")
+								}
+								return nil
+							},
+							Action: roer.PipelineExecutionsWatchAction(clientConfig),
+						},
+						{
+							Name:      "cancel",
+							Usage:     "cancel a running pipeline execution",
+							ArgsUsage: "[executionId]",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "reason",
+									Usage: "reason for canceling, shown alongside the execution",
+								},
+							},
+							Before: func(cc *cli.Context) error {
+								if cc.NArg() != 1 {
+									return errors.New("execution id is required")
+								}
+								return nil
+							},
+							Action: roer.PipelineExecutionsCancelAction(clientConfig),
+						},
+						{
+							Name:      "pause",
+							Usage:     "pause a running pipeline execution",
+							ArgsUsage: "[executionId]",
+							Before: func(cc *cli.Context) error {
+								if cc.NArg() != 1 {
+									return errors.New("execution id is required")
+								}
+								return nil
+							},
+							Action: roer.PipelineExecutionsPauseAction(clientConfig),
+						},
+						{
+							Name:      "resume",
+							Usage:     "resume a paused pipeline execution",
+							ArgsUsage: "[executionId]",
+							Before: func(cc *cli.Context) error {
+								if cc.NArg() != 1 {
+									return errors.New("execution id is required")
+								}
+								return nil
+							},
+							Action: roer.PipelineExecutionsResumeAction(clientConfig),
+						},
+						{
+							Name:      "judge",
+							Usage:     "continue or stop an execution waiting at a manual judgment stage",
+							ArgsUsage: "[executionId]",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "stage",
+									Usage: "refId or name of the manual judgment stage",
+								},
+								cli.BoolFlag{
+									Name:  "continue",
+									Usage: "continue the execution",
+								},
+								cli.BoolFlag{
+									Name:  "stop",
+									Usage: "stop the execution",
+								},
+								cli.StringFlag{
+									Name:  "input",
+									Usage: "judgment input, one of the options offered by the stage",
+								},
+								cli.StringFlag{
+									Name:  "message",
+									Usage: "message recorded with the judgment",
+								},
+							},
+							Before: func(cc *cli.Context) error {
+								if cc.NArg() != 1 {
+									return errors.New("execution id is required")
+								}
+								if cc.String("stage") == "" {
+									return errors.New("--stage is required")
+								}
+								if cc.Bool("continue") == cc.Bool("stop") {
+									return errors.New("exactly one of --continue or --stop is required")
+								}
+								return nil
+							},
+							Action: roer.PipelineExecutionsJudgeAction(clientConfig),
+						},
+						{
+							Name:      "restart",
+							Usage:     "restart a stage of a failed pipeline execution",
+							ArgsUsage: "[executionId]",
+							Flags: append([]cli.Flag{
+								cli.StringFlag{
+									Name:  "stage",
+									Usage: "refId or name of the stage to restart",
+								},
+								cli.BoolFlag{
+									Name:  "monitor, m",
+									Usage: "Continue to monitor the execution after restarting the stage",
+								},
+							}, monitorFlags()...),
+							Before: func(cc *cli.Context) error {
+								if cc.NArg() != 1 {
+									return errors.New("execution id is required")
+								}
+								if cc.String("stage") == "" {
+									return errors.New("--stage is required")
+								}
+								return nil
+							},
+							Action: roer.PipelineExecutionsRestartAction(clientConfig),
+						},
+					},
+				},
 			},
 		},
 		{
@@ -131,20 +388,90 @@ func NewRoer(version string, clientConfig spinnaker.ClientConfig) *cli.App {
 					Usage:  "list applications",
 					Action: roer.AppListAction(clientConfig),
 				},
+				{
+					Name:  "backup",
+					Usage: "back up applications to an archive",
+					Description: `
+		Writes a versioned tar.gz archive holding the attributes of
+		each application, its pipelines and strategies, and the
+		pipeline templates its pipelines are planned from, along
+		with their parents.
+					`,
+					ArgsUsage: "[app name...]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "out, o",
+							Usage: "archive to write",
+						},
+					},
+					Before: func(cc *cli.Context) error {
+						if cc.NArg() == 0 {
+							return errors.New("at least one application name is required")
+						}
+						if cc.String("out") == "" {
+							return errors.New("--out is required")
+						}
+						return nil
+					},
+					Action: roer.AppBackupAction(clientConfig),
+				},
+				{
+					Name:  "restore",
+					Usage: "restore applications from a backup archive",
+					Description: `
+		Publishes the templates of a backup archive, creates or
+		updates its applications and saves their pipelines and
+		strategies. Pipelines and strategies are matched to existing
+		ones by name, so a restore can safely be run again.
+		Applications can be restored under another name with
+		--remap old=new; references to them and to their pipelines
+		are rewritten.
+					`,
+					ArgsUsage: "[archive]",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{
+							Name:  "remap",
+							Usage: "restore an application under another name as old=new, may be repeated",
+						},
+						cli.BoolFlag{
+							Name:  "skip-templates",
+							Usage: "do not publish the pipeline templates of the archive",
+						},
+					},
+					Before: func(cc *cli.Context) error {
+						if cc.NArg() != 1 {
+							return errors.New("backup archive is required")
+						}
+						return nil
+					},
+					Action: roer.AppRestoreAction(clientConfig),
+				},
 				{
 					Name:      "exec",
 					Usage:     "execute pipeline",
 					ArgsUsage: "[application name] [pipeline name]",
-					Flags: []cli.Flag{
+					Flags: append([]cli.Flag{
 						cli.BoolFlag{
 							Name:  "monitor, m",
 							Usage: "Continue to monitor the executing of the pipeline",
 						},
-						cli.IntFlag{
-							Name:  "retry, r",
-							Usage: "Number of times to have the monitor retry if a call fails or times out",
+						cli.StringSliceFlag{
+							Name:  "param, p",
+							Usage: "pipeline parameter as key=value, may be repeated",
 						},
-					},
+						cli.StringFlag{
+							Name:  "params-file",
+							Usage: "YAML or JSON file of pipeline parameters, overridden by --param",
+						},
+						cli.StringSliceFlag{
+							Name:  "artifact",
+							Usage: "trigger artifact as JSON or key=value pairs (type=...,name=...,reference=...), may be repeated",
+						},
+						cli.StringFlag{
+							Name:  "user",
+							Usage: "user to record as the trigger user",
+						},
+					}, monitorFlags()...),
 					Before: func(cc *cli.Context) error {
 						if cc.NArg() != 2 {
 							return errors.New("app name and pipeline are required")
@@ -160,9 +487,16 @@ func NewRoer(version string, clientConfig spinnaker.ClientConfig) *cli.App {
 			Usage: "pipeline template tasks",
 			Subcommands: []cli.Command{
 				{
-					Name:      "publish",
-					Usage:     "publish a pipeline template, will create or update a template",
-					ArgsUsage: "[template.yml]",
+					Name:  "publish",
+					Usage: "publish a pipeline template, will create or update a template",
+					Description: `
+		Publishes one or more templates, given as files, directories
+		or glob patterns. When publishing several templates, parents
+		are published before the templates referring to them by
+		source, and the run stops at the first template that fails
+		to publish unless --continue-on-error is given.
+					`,
+					ArgsUsage: "[template.yml | dir | glob...]",
 					Flags: []cli.Flag{
 						cli.BoolFlag{
 							Name:  "update, u",
@@ -180,15 +514,73 @@ func NewRoer(version string, clientConfig spinnaker.ClientConfig) *cli.App {
 							Name:  "source",
 							Usage: "override or add the source template",
 						},
+						cli.BoolFlag{
+							Name:  "preview",
+							Usage: "plan dependent pipelines against the template and show how they change, without publishing",
+						},
+						cli.BoolFlag{
+							Name:  "continue-on-error",
+							Usage: "when publishing several templates, keep publishing the others after one fails",
+						},
 					},
 					Before: func(cc *cli.Context) error {
-						if cc.NArg() != 1 {
+						if cc.NArg() == 0 {
 							return errors.New("path to template file is required")
 						}
 						return nil
 					},
 					Action: roer.PipelineTemplatePublishAction(clientConfig),
 				},
+				{
+					Name:  "list",
+					Usage: "list pipeline templates",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{
+							Name:  "scope, s",
+							Usage: "only list templates with the given scope, may be repeated",
+						},
+						cli.StringFlag{
+							Name:  "owner",
+							Usage: "only list templates owned by the given owner",
+						},
+					},
+					Action: roer.PipelineTemplateListAction(clientConfig),
+				},
+				{
+					Name:      "get",
+					Usage:     "get a pipeline template",
+					ArgsUsage: "[id]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "output format, yaml or json",
+							Value: "yaml",
+						},
+						cli.StringFlag{
+							Name:  "out",
+							Usage: "write the template to a file instead of stdout",
+						},
+					},
+					Before: func(cc *cli.Context) error {
+						if cc.NArg() != 1 {
+							return errors.New("id is required")
+						}
+						return nil
+					},
+					Action: roer.PipelineTemplateGetAction(clientConfig),
+				},
+				{
+					Name:      "dependents",
+					Usage:     "list the pipelines that depend on a pipeline template",
+					ArgsUsage: "[id]",
+					Before: func(cc *cli.Context) error {
+						if cc.NArg() != 1 {
+							return errors.New("id is required")
+						}
+						return nil
+					},
+					Action: roer.PipelineTemplateDependentsAction(clientConfig),
+				},
 				{
 					Name:  "plan",
 					Usage: "validate a pipeline template and or plan a configuration",
@@ -203,15 +595,144 @@ func NewRoer(version string, clientConfig spinnaker.ClientConfig) *cli.App {
 							Name:  "template, t",
 							Usage: "local template to inline while planning",
 						},
+						templatePathFlag(),
+						cli.StringFlag{
+							Name:  "fail-on",
+							Usage: "lowest error severity that fails the plan: warn or fatal",
+							Value: "fatal",
+						},
 					},
 					Before: func(cc *cli.Context) error {
 						if cc.NArg() != 1 {
 							return errors.New("path to configuration file is required")
 						}
+						if f := cc.String("fail-on"); f != "warn" && f != "fatal" {
+							return errors.New("fail-on must be warn or fatal")
+						}
 						return nil
 					},
 					Action: roer.PipelineTemplatePlanAction(clientConfig),
 				},
+				{
+					Name:  "resolve",
+					Usage: "resolve the source chain of a template and print the merged template",
+					Description: `
+		Walks the source chain of a local template, or of a
+		spinnaker:// template found in --template-path, and prints
+		the template with all of its parents merged in. Parents that
+		are not local are fetched from Spinnaker unless --offline is
+		given.
+					`,
+					ArgsUsage: "[template.yml | spinnaker://id]",
+					Flags: []cli.Flag{
+						templatePathFlag(),
+						cli.BoolFlag{
+							Name:  "offline",
+							Usage: "only resolve templates from local files",
+						},
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "output format, yaml or json",
+							Value: "yaml",
+						},
+						cli.StringFlag{
+							Name:  "out",
+							Usage: "write the template to a file instead of stdout",
+						},
+					},
+					Before: func(cc *cli.Context) error {
+						if cc.NArg() != 1 {
+							return errors.New("path to template file or template source is required")
+						}
+						return nil
+					},
+					Action: roer.PipelineTemplateResolveAction(clientConfig),
+				},
+				{
+					Name:  "render",
+					Usage: "render a pipeline template configuration to the final pipeline JSON",
+					Description: `
+		Renders a pipeline template configuration and its template to
+		the pipeline that would be executed. With --offline the
+		pipeline is rendered locally, without contacting Spinnaker,
+		from the template given with --template or the file://
+		template source of the configuration.
+					`,
+					ArgsUsage: "[configuration.yml]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "template, t",
+							Usage: "local template to render the configuration with",
+						},
+						templatePathFlag(),
+						cli.BoolFlag{
+							Name:  "offline",
+							Usage: "render locally instead of planning through Spinnaker",
+						},
+					},
+					Before: func(cc *cli.Context) error {
+						if cc.NArg() != 1 {
+							return errors.New("path to configuration file is required")
+						}
+						return nil
+					},
+					Action: roer.PipelineTemplateRenderAction(clientConfig),
+				},
+				{
+					Name:  "test",
+					Usage: "plan template test cases and compare them with golden files",
+					Description: `
+		Finds every *.config.yml configuration in the directory, plans
+		it and compares the result with the golden file next to it:
+		*.expected.json for the planned pipeline, or *.errors.json for
+		the expected plan errors. Generated ids and the trigger are
+		left out of the comparison. Use --update to rewrite the golden
+		files from the current results.
+					`,
+					ArgsUsage: "[dir]",
+					Flags: []cli.Flag{
+						templatePathFlag(),
+						cli.BoolFlag{
+							Name:  "offline",
+							Usage: "render locally instead of planning through Spinnaker",
+						},
+						cli.BoolFlag{
+							Name:  "update",
+							Usage: "rewrite the golden files instead of comparing with them",
+						},
+					},
+					Before: func(cc *cli.Context) error {
+						if cc.NArg() > 1 {
+							return errors.New("only one test directory may be given")
+						}
+						return nil
+					},
+					Action: roer.PipelineTemplateTestAction(clientConfig),
+				},
+				{
+					Name:  "docs",
+					Usage: "generate Markdown documentation for pipeline templates",
+					Description: `
+		Generates a Markdown page for each template, describing its
+		metadata, variables, stages and their dependency graph,
+		modules and partials. Pages are printed to stdout, or written
+		to --out-dir along with an index page.
+					`,
+					ArgsUsage: "[template.yml...]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "out-dir",
+							Usage: "directory to write a page per template and an index to",
+						},
+					},
+					Before: func(cc *cli.Context) error {
+						if cc.NArg() == 0 {
+							return errors.New("at least one template file is required")
+						}
+						return nil
+					},
+					Action: roer.PipelineTemplateDocsAction(clientConfig),
+				},
 				{
 					Name:      "convert",
 					Usage:     "converts an existing, non-templated pipeline config into a scaffolded template",
@@ -232,6 +753,10 @@ func NewRoer(version string, clientConfig spinnaker.ClientConfig) *cli.App {
 							Name:  "id",
 							Usage: "id of the template to delete",
 						},
+						cli.BoolFlag{
+							Name:  "force",
+							Usage: "delete the template even if pipelines still depend on it",
+						},
 					},
 					Before: func(cc *cli.Context) error {
 						if cc.NArg() != 1 {
@@ -255,6 +780,63 @@ func NewRoer(version string, clientConfig spinnaker.ClientConfig) *cli.App {
 				// },
 			},
 		},
+		{
+			Name:  "migrate",
+			Usage: "copy applications between Spinnaker installations",
+			Subcommands: []cli.Command{
+				{
+					Name:  "preflight",
+					Usage: "report references that cannot be resolved in the target",
+					Description: `
+		Fetches the applications from SPINNAKER_API, rewrites them
+		by the rules and lists the accounts, regions, applications
+		and pipelines they refer to that do not exist in the target
+		and are not migrated along. Nothing is written.
+					`,
+					ArgsUsage: "[app name...]",
+					Flags:     migrateFlags(),
+					Before:    validateMigrateArgs,
+					Action:    roer.MigratePreflightAction(clientConfig),
+				},
+				{
+					Name:  "app",
+					Usage: "copy applications, their pipelines, strategies and templates to the target",
+					Description: `
+		Copies applications from SPINNAKER_API to the target
+		Spinnaker, along with their pipelines, strategies and the
+		pipeline templates their pipelines are planned from. Account
+		names, regions, docker registries and application names are
+		rewritten by the rules file:
+
+		  accounts:
+		    prod-aws: aws-prod
+		  regions:
+		    us-west-1: us-west-2
+		  dockerRegistries:
+		    registry.old.example.com: registry.example.com
+		  applications:
+		    billing: billing-eu
+
+		The migration stops before writing anything when a reference
+		cannot be resolved in the target, unless --force is set. Like
+		app restore, it can safely be run again.
+					`,
+					ArgsUsage: "[app name...]",
+					Flags: append(migrateFlags(),
+						cli.BoolFlag{
+							Name:  "force",
+							Usage: "migrate even when references cannot be resolved in the target",
+						},
+						cli.BoolFlag{
+							Name:  "skip-templates",
+							Usage: "do not copy pipeline templates",
+						},
+					),
+					Before: validateMigrateArgs,
+					Action: roer.MigrateAppAction(clientConfig),
+				},
+			},
+		},
 	}
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
@@ -307,6 +889,96 @@ func NewRoer(version string, clientConfig spinnaker.ClientConfig) *cli.App {
 	return app
 }
 
+// monitorFlags are the flags shared by all commands that monitor an execution
+func monitorFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.IntFlag{
+			Name:  "retry, r",
+			Usage: "Number of consecutive transient failures (network errors, timeouts, 5xx) the monitor retries",
+			Value: 5,
+		},
+		cli.IntFlag{
+			Name:  "monitor-timeout",
+			Usage: "Timeout (in seconds) for monitoring the execution, defaults to --timeout if set or 30 minutes",
+		},
+		cli.IntFlag{
+			Name:  "poll-interval",
+			Usage: "Interval (in seconds) between execution status polls",
+			Value: 1,
+		},
+		reportFlag(),
+	}
+}
+
+// migrateFlags are the flags of the migrate commands: the rules file and the
+// endpoint and authentication of the target Spinnaker
+func migrateFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "rules",
+			Usage: "YAML file of account, region, docker registry and application rewrite rules",
+		},
+		cli.StringFlag{
+			Name:   "target-api",
+			Usage:  "Gate endpoint of the target Spinnaker",
+			EnvVar: "SPINNAKER_TARGET_API",
+		},
+		cli.StringFlag{
+			Name:   "target-cert-path",
+			Usage:  "HTTPS x509 cert path for the target",
+			EnvVar: "SPINNAKER_TARGET_CLIENT_CERT",
+		},
+		cli.StringFlag{
+			Name:   "target-key-path",
+			Usage:  "HTTPS x509 key path for the target",
+			EnvVar: "SPINNAKER_TARGET_CLIENT_KEY",
+		},
+		cli.StringFlag{
+			Name:  "target-api-session",
+			Usage: "your active api session with the target",
+		},
+		cli.BoolFlag{
+			Name:  "target-insecure",
+			Usage: "Bypass TLS certificate validation of the target",
+		},
+		cli.StringFlag{
+			Name:  "target-fiat-user",
+			Usage: "Username for Fiat auth with the target",
+		},
+		cli.StringFlag{
+			Name:  "target-fiat-pass",
+			Usage: "Password for Fiat auth with the target",
+		},
+	}
+}
+
+func validateMigrateArgs(cc *cli.Context) error {
+	if cc.NArg() == 0 {
+		return errors.New("at least one application name is required")
+	}
+	if cc.String("rules") != "" {
+		validateFileExists("rules", cc.String("rules"))
+	}
+	return nil
+}
+
+// templatePathFlag is the flag for directories of local templates, which
+// spinnaker:// template sources are resolved from
+func templatePathFlag() cli.Flag {
+	return cli.StringSliceFlag{
+		Name:  "template-path",
+		Usage: "directory of local templates to resolve spinnaker:// sources from, may be repeated",
+	}
+}
+
+// reportFlag is the flag for writing execution reports
+func reportFlag() cli.Flag {
+	return cli.StringSliceFlag{
+		Name:  "report",
+		Usage: "write an execution report as junit=path or json=path, may be repeated",
+	}
+}
+
 func validateFileExists(name, f string) {
 	if _, err := os.Stat(f); os.IsNotExist(err) {
 		logrus.WithFields(logrus.Fields{
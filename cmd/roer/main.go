@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer"
 	"github.com/spinnaker/roer/cmd"
 	"github.com/spinnaker/roer/spinnaker"
 )
@@ -14,15 +15,15 @@ var version = "dev"
 func main() {
 	// TODO rz - Don't really like this bit. Standardize a spinnaker config file.
 	// maybe worthwhile splitting out this spinnaker API into a standard lib...
-	if os.Getenv("SPINNAKER_API") == "" {
-		logrus.Fatal("SPINNAKER_API must be set")
-	}
-
+	// SPINNAKER_API is checked when a command creates a client, so offline
+	// commands work without it.
 	config := spinnaker.ClientConfig{
-		Endpoint:          os.Getenv("SPINNAKER_API"),
-		HTTPClientFactory: spinnaker.DefaultHTTPClientFactory,
+		Endpoint:                os.Getenv("SPINNAKER_API"),
+		HTTPClientFactory:       spinnaker.DefaultHTTPClientFactory,
+		TargetHTTPClientFactory: spinnaker.TargetHTTPClientFactory,
 	}
 	if err := cmd.NewRoer(version, config).Run(os.Args); err != nil {
-		logrus.Fatal(err.Error())
+		logrus.Error(err.Error())
+		os.Exit(roer.ExitCode(err))
 	}
 }
@@ -0,0 +1,375 @@
+package roer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+	a, b int // line numbers in the old and new text
+}
+
+// unifiedDiff returns a unified diff between two texts, or an empty string if
+// they are equal.
+func unifiedDiff(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromName, toName)
+	for start := 0; start < len(ops); {
+		// Find the next change and the extent of the hunk around it.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		hunkStart := first - diffContext
+		if hunkStart < start {
+			hunkStart = start
+		}
+		hunkEnd := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				hunkEnd = i + 1
+			} else if i-hunkEnd >= 2*diffContext {
+				break
+			}
+		}
+		hunkEnd += diffContext
+		if hunkEnd > len(ops) {
+			hunkEnd = len(ops)
+		}
+
+		aStart, bStart, aLen, bLen := ops[hunkStart].a, ops[hunkStart].b, 0, 0
+		for _, op := range ops[hunkStart:hunkEnd] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", aStart+1, aLen, bStart+1, bLen)
+		for _, op := range ops[hunkStart:hunkEnd] {
+			fmt.Fprintf(&buf, "%c%s\n", op.kind, op.line)
+		}
+		start = hunkEnd
+	}
+	return buf.String()
+}
+
+// diffLines computes the edit script between two lists of lines using their
+// longest common subsequence. The common prefix and suffix are matched
+// directly, and the lines in between are diffed in linear space.
+func diffLines(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, diffOp{' ', a[prefix], prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops = diffRange(ops, a, b, prefix, len(a)-suffix, prefix, len(b)-suffix)
+	for k := suffix; k > 0; k-- {
+		i, j := len(a)-k, len(b)-k
+		ops = append(ops, diffOp{' ', a[i], i, j})
+	}
+	return ops
+}
+
+// diffRange appends the edit script between a[a0:a1] and b[b0:b1]. Following
+// Hirschberg, it splits a in half, finds where a longest common subsequence
+// crosses the split from two rows of LCS lengths, and recurses on both sides,
+// so memory stays linear in the number of lines.
+func diffRange(ops []diffOp, a, b []string, a0, a1, b0, b1 int) []diffOp {
+	switch {
+	case a0 == a1:
+		for j := b0; j < b1; j++ {
+			ops = append(ops, diffOp{'+', b[j], a0, j})
+		}
+		return ops
+	case b0 == b1:
+		for i := a0; i < a1; i++ {
+			ops = append(ops, diffOp{'-', a[i], i, b0})
+		}
+		return ops
+	case a1-a0 == 1:
+		for j := b0; j < b1; j++ {
+			if a[a0] == b[j] {
+				ops = diffRange(ops, a, b, a0, a0, b0, j)
+				ops = append(ops, diffOp{' ', a[a0], a0, j})
+				return diffRange(ops, a, b, a1, a1, j+1, b1)
+			}
+		}
+		ops = append(ops, diffOp{'-', a[a0], a0, b0})
+		return diffRange(ops, a, b, a1, a1, b0, b1)
+	}
+
+	mid := (a0 + a1) / 2
+	forward := lcsLengths(a[a0:mid], b[b0:b1])
+	backward := lcsSuffixLengths(a[mid:a1], b[b0:b1])
+	best, split := -1, b0
+	for k := 0; k <= b1-b0; k++ {
+		if n := forward[k] + backward[k]; n > best {
+			best, split = n, b0+k
+		}
+	}
+	ops = diffRange(ops, a, b, a0, mid, b0, split)
+	return diffRange(ops, a, b, mid, a1, split, b1)
+}
+
+// lcsLengths returns the length of the longest common subsequence of a and
+// each prefix b[:k].
+func lcsLengths(a, b []string) []int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := 1; j <= len(b); j++ {
+			switch {
+			case a[i] == b[j-1]:
+				cur[j] = prev[j-1] + 1
+			case prev[j] >= cur[j-1]:
+				cur[j] = prev[j]
+			default:
+				cur[j] = cur[j-1]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+// lcsSuffixLengths returns the length of the longest common subsequence of a
+// and each suffix b[k:].
+func lcsSuffixLengths(a, b []string) []int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				cur[j] = prev[j+1] + 1
+			case prev[j] >= cur[j+1]:
+				cur[j] = prev[j]
+			default:
+				cur[j] = cur[j+1]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// normalizePlan removes the values Orca generates anew on every plan, such as
+// stage id UUIDs, and the trigger of the plan request, so that two plans of
+// the same pipeline can be compared. The result is indented JSON with sorted
+// keys.
+func normalizePlan(plan []byte) (string, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(plan, &m); err != nil {
+		return "", err
+	}
+
+	delete(m, "id")
+	delete(m, "trigger")
+	if stages, ok := m["stages"].([]interface{}); ok {
+		for _, s := range stages {
+			if stage, ok := s.(map[string]interface{}); ok {
+				delete(stage, "id")
+			}
+		}
+	}
+
+	return canonicalJSON(m)
+}
+
+// valueChange is a difference between two decoded JSON documents.
+type valueChange struct {
+	path     string
+	kind     byte // '~' changed, '-' removed or '+' added
+	from, to interface{}
+}
+
+// diffValues compares two decoded JSON documents. Lists of objects that all
+// have a refId, such as stages, or all have a name, such as triggers, are
+// compared by that key rather than by position, so reordering them is not a
+// change.
+func diffValues(path string, from, to interface{}) []valueChange {
+	switch f := from.(type) {
+	case map[string]interface{}:
+		t, ok := to.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := []string{}
+		for k := range f {
+			keys = append(keys, k)
+		}
+		for k := range t {
+			if _, ok := f[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		changes := []valueChange{}
+		for _, k := range keys {
+			fv, inFrom := f[k]
+			tv, inTo := t[k]
+			switch {
+			case !inTo:
+				changes = append(changes, valueChange{joinPath(path, k), '-', fv, nil})
+			case !inFrom:
+				changes = append(changes, valueChange{joinPath(path, k), '+', nil, tv})
+			default:
+				changes = append(changes, diffValues(joinPath(path, k), fv, tv)...)
+			}
+		}
+		return changes
+	case []interface{}:
+		t, ok := to.([]interface{})
+		if !ok {
+			break
+		}
+		for _, key := range []string{"refId", "name"} {
+			if fk, ok := listKeys(f, key); ok {
+				if tk, ok := listKeys(t, key); ok {
+					return diffKeyedLists(path, f, t, fk, tk)
+				}
+			}
+		}
+
+		changes := []valueChange{}
+		for i := 0; i < len(f) || i < len(t); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(t):
+				changes = append(changes, valueChange{p, '-', f[i], nil})
+			case i >= len(f):
+				changes = append(changes, valueChange{p, '+', nil, t[i]})
+			default:
+				changes = append(changes, diffValues(p, f[i], t[i])...)
+			}
+		}
+		return changes
+	}
+
+	if reflect.DeepEqual(from, to) {
+		return nil
+	}
+	return []valueChange{{path, '~', from, to}}
+}
+
+// listKeys returns the key of every item of a list, if every item is an object
+// with a unique, non-empty string value for the key.
+func listKeys(list []interface{}, key string) ([]string, bool) {
+	keys := make([]string, len(list))
+	seen := map[string]bool{}
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		k, ok := m[key].(string)
+		if !ok || k == "" || seen[k] {
+			return nil, false
+		}
+		keys[i] = k
+		seen[k] = true
+	}
+	return keys, true
+}
+
+func diffKeyedLists(path string, from, to []interface{}, fromKeys, toKeys []string) []valueChange {
+	toIndex := map[string]int{}
+	for i, k := range toKeys {
+		toIndex[k] = i
+	}
+	fromIndex := map[string]int{}
+	changes := []valueChange{}
+	for i, k := range fromKeys {
+		fromIndex[k] = i
+		p := fmt.Sprintf("%s[%s]", path, k)
+		if j, ok := toIndex[k]; ok {
+			changes = append(changes, diffValues(p, from[i], to[j])...)
+		} else {
+			changes = append(changes, valueChange{p, '-', from[i], nil})
+		}
+	}
+	for j, k := range toKeys {
+		if _, ok := fromIndex[k]; !ok {
+			changes = append(changes, valueChange{fmt.Sprintf("%s[%s]", path, k), '+', nil, to[j]})
+		}
+	}
+	return changes
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// formatChanges formats changes one per line, such as
+// "~ stages[wait].waitTime: 5 -> 10".
+func formatChanges(changes []valueChange, indent string) string {
+	var buf bytes.Buffer
+	for _, c := range changes {
+		switch c.kind {
+		case '~':
+			fmt.Fprintf(&buf, "%s~ %s: %s -> %s\n", indent, c.path, formatValue(c.from), formatValue(c.to))
+		case '-':
+			fmt.Fprintf(&buf, "%s- %s: %s\n", indent, c.path, formatValue(c.from))
+		case '+':
+			fmt.Fprintf(&buf, "%s+ %s: %s\n", indent, c.path, formatValue(c.to))
+		}
+	}
+	return buf.String()
+}
+
+// formatValue formats a value as compact JSON, shortening long values.
+func formatValue(v interface{}) string {
+	const maxLength = 100
+	dat, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	if len(dat) > maxLength {
+		return string(dat[:maxLength-3]) + "..."
+	}
+	return string(dat)
+}
+
+// canonicalJSON reformats JSON as indented JSON with sorted keys.
+func canonicalJSON(v interface{}) (string, error) {
+	dat, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(dat) + "\n", nil
+}
@@ -0,0 +1,131 @@
+package roer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// errDriftDetected is returned when a pipeline in Spinnaker differs from its
+// local definition.
+var errDriftDetected = errors.New("drift detected")
+
+// pipelineDrift compares a local pipeline definition with the pipeline of the
+// same application and name in Spinnaker. Templated pipeline configurations
+// are compared by their planned pipelines. It returns the changes that would
+// turn the remote pipeline into the local one, and false if the pipeline does
+// not exist in Spinnaker.
+func pipelineDrift(cc *cli.Context, client spinnaker.Client, file string, local map[string]interface{}, config map[string]interface{}) ([]valueChange, bool, error) {
+	app, name := pipelineField(local, "application"), pipelineField(local, "name")
+	remote, err := client.GetPipelineConfigMap(app, name)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "fetching pipeline %s", name)
+	}
+	if remote == nil {
+		return nil, false, nil
+	}
+
+	// Raw pipelines are compared field by field, including the fields
+	// PipelineConfig does not model, such as disabled, locked and roles.
+	if config == nil {
+		from, err := normalizePipeline(remote)
+		if err != nil {
+			return nil, true, err
+		}
+		to, err := normalizePipeline(local)
+		if err != nil {
+			return nil, true, err
+		}
+		return diffValues("", from, to), true, nil
+	}
+
+	to, err := planLocalConfiguration(cc, client, file, config)
+	if err != nil {
+		return nil, true, err
+	}
+	from, err := plannedRemotePipeline(client, remote)
+	if err != nil {
+		return nil, true, err
+	}
+	return diffValues("", from, to), true, nil
+}
+
+// planLocalConfiguration plans a pipeline template configuration, inlining
+// its template when it resolves locally, like `pipeline-template plan`.
+func planLocalConfiguration(cc *cli.Context, client spinnaker.Client, file string, config map[string]interface{}) (map[string]interface{}, error) {
+	resolver := newTemplateResolver(cc.StringSlice("template-path"), client)
+	template, templateFile, err := configurationTemplate(resolver, file, config, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving pipeline template")
+	}
+
+	sources := newPlanSources(file, templateFile)
+	checked := template
+	if checked == nil {
+		checked = publishedConfigurationTemplate(resolver, config)
+	}
+	if checked != nil {
+		if err := validateConfigurationVariables(checked, config, sources, "fatal"); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := client.Plan(config, template)
+	if err != nil {
+		if err == spinnaker.ErrInvalidPipelineTemplate {
+			if planErrors, decodeErr := decodePlanErrors(resp); decodeErr == nil {
+				printPlanErrors(planErrors, sources)
+			}
+			return nil, err
+		}
+		return nil, errors.Wrapf(err, "planning %s", file)
+	}
+	return normalizePlannedPipeline(resp)
+}
+
+// plannedRemotePipeline returns the pipeline Spinnaker runs for a pipeline
+// config: the plan of its configuration for templated pipelines, and the
+// config itself otherwise.
+func plannedRemotePipeline(client spinnaker.Client, remote map[string]interface{}) (map[string]interface{}, error) {
+	config, ok := remote["config"].(map[string]interface{})
+	if remote["type"] != "templatedPipeline" || !ok {
+		dat, err := json.Marshal(remote)
+		if err != nil {
+			return nil, err
+		}
+		return normalizePlannedPipeline(dat)
+	}
+
+	resp, err := client.Plan(config, nil)
+	if err != nil {
+		logrus.Debug(string(resp))
+		return nil, errors.Wrapf(err, "planning the configuration of pipeline %s in Spinnaker", pipelineField(remote, "name"))
+	}
+	return normalizePlannedPipeline(resp)
+}
+
+// normalizePlannedPipeline decodes a planned or saved pipeline without the
+// values generated on every plan or save.
+func normalizePlannedPipeline(dat []byte) (map[string]interface{}, error) {
+	normalized, err := normalizePlan(dat)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding pipeline")
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(normalized), &m); err != nil {
+		return nil, err
+	}
+	for _, f := range volatilePipelineFields {
+		delete(m, f)
+	}
+	return m, nil
+}
+
+func printPipelineDrift(app, name, file string, changes []valueChange) {
+	fmt.Printf("--- spinnaker: %s/%s\n+++ %s\n", app, name, file)
+	fmt.Print(formatChanges(changes, ""))
+}
@@ -0,0 +1,112 @@
+package roer
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// Process exit codes, so CI scripts can branch on why roer failed. Any error
+// not covered below exits with ExitCodeError. Codes are never renumbered once
+// released, so new ones are added at the end.
+const (
+	// ExitCodeSucceeded is returned when the command, and any execution or
+	// task it waited for, succeeded.
+	ExitCodeSucceeded = 0
+	// ExitCodeError is returned for any other failure.
+	ExitCodeError = 1
+	// ExitCodeDriftDetected is returned when a pipeline in Spinnaker differs
+	// from its local definition.
+	ExitCodeDriftDetected = 2
+	// ExitCodeTerminal is returned when an execution or task ended TERMINAL,
+	// or with any other unsuccessful status than CANCELED.
+	ExitCodeTerminal = 3
+	// ExitCodeCanceled is returned when an execution or task was canceled.
+	ExitCodeCanceled = 4
+	// ExitCodeTimeout is returned when an execution or task did not complete
+	// within the monitor or polling timeout.
+	ExitCodeTimeout = 5
+	// ExitCodeInvalidTemplate is returned when a pipeline template or
+	// configuration failed validation.
+	ExitCodeInvalidTemplate = 6
+	// ExitCodeUnauthorized is returned when Spinnaker rejected the
+	// credentials or denied access.
+	ExitCodeUnauthorized = 7
+	// ExitCodeNotFound is returned when a requested resource does not exist.
+	ExitCodeNotFound = 8
+	// ExitCodeInvalidParameters is returned when the parameters given to a
+	// pipeline execution do not satisfy the parameters the pipeline declares.
+	ExitCodeInvalidParameters = 9
+)
+
+// ExitCode maps an error returned by a roer command to the process exit code.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitCodeSucceeded
+	}
+
+	switch cause := errors.Cause(err).(type) {
+	case *ExecutionStatusError:
+		if cause.Status == "CANCELED" {
+			return ExitCodeCanceled
+		}
+		return ExitCodeTerminal
+	case notFoundError:
+		return ExitCodeNotFound
+	case *invalidParametersError:
+		return ExitCodeInvalidParameters
+	case *spinnaker.ResponseError:
+		switch cause.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return ExitCodeUnauthorized
+		case http.StatusNotFound:
+			return ExitCodeNotFound
+		}
+	}
+
+	switch errors.Cause(err) {
+	case errMonitorTimeout, spinnaker.ErrTaskTimeout:
+		return ExitCodeTimeout
+	case spinnaker.ErrInvalidPipelineTemplate:
+		return ExitCodeInvalidTemplate
+	case errDriftDetected:
+		return ExitCodeDriftDetected
+	}
+
+	return ExitCodeError
+}
+
+// ExecutionStatusError is returned when an execution or task completed with
+// any other status than SUCCEEDED.
+type ExecutionStatusError struct {
+	ID     string
+	Status string
+}
+
+func (e *ExecutionStatusError) Error() string {
+	return fmt.Sprintf("execution %s did not complete with a SUCCESS status.  Ended with status: %s", e.ID, e.Status)
+}
+
+// invalidParametersError is returned when execution parameters are missing or
+// not among the options the pipeline allows.
+type invalidParametersError struct {
+	problems []string
+}
+
+func (e *invalidParametersError) Error() string {
+	return "invalid pipeline parameters: " + strings.Join(e.problems, "; ")
+}
+
+// notFoundError is returned when a resource roer looked up does not exist.
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+func notFound(format string, args ...interface{}) error {
+	return notFoundError(fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,58 @@
+package roer
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// pipelineFileName returns the name of the file a pipeline is exported to.
+func pipelineFileName(name, format string) string {
+	ext := ".json"
+	if format != "json" {
+		ext = ".yml"
+	}
+	return unsafeFileNameChars.ReplaceAllString(name, "-") + ext
+}
+
+// exportPipeline returns the map written to the file of a pipeline. Every
+// field of the pipeline is kept. With stripVolatile set, the fields Spinnaker
+// sets on every save and the generated stage ids are left out, so exports
+// only differ when the pipeline does.
+func exportPipeline(pipeline map[string]interface{}, stripVolatile bool) (map[string]interface{}, error) {
+	if stripVolatile {
+		return normalizePipeline(pipeline)
+	}
+	return pipeline, nil
+}
+
+// exportPipelines writes each pipeline to a file in dir, named after the
+// pipeline.
+func exportPipelines(pipelines []map[string]interface{}, dir, format string, stripVolatile bool) error {
+	written := map[string]string{}
+	for _, p := range pipelines {
+		name := pipelineField(p, "name")
+		file := pipelineFileName(name, format)
+		if other, ok := written[file]; ok {
+			return fmt.Errorf("pipelines %q and %q would both be exported to %s", other, name, file)
+		}
+		written[file] = name
+
+		m, err := exportPipeline(p, stripVolatile)
+		if err != nil {
+			return errors.Wrapf(err, "converting pipeline %s", name)
+		}
+		dat, err := marshalOutput(m, format)
+		if err != nil {
+			return errors.Wrapf(err, "marshaling pipeline %s", name)
+		}
+		if err := writeOutput(filepath.Join(dir, file), dat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,388 @@
+package roer
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// accountKeys are the keys pipeline stages, triggers and clusters refer to
+// accounts by.
+var accountKeys = []string{"account", "accountName", "credentials", "deploymentAccount"}
+
+func isAccountKey(key string) bool {
+	for _, k := range accountKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// isExpression reports whether a value is a SpEL or Jinja expression, which
+// can only be resolved when the pipeline runs or is planned.
+func isExpression(s string) bool {
+	return strings.Contains(s, "${") || strings.Contains(s, "{{")
+}
+
+// migrationRules rewrite references to resources named differently in the
+// target Spinnaker. Each rule maps a name in the source to its name in the
+// target.
+type migrationRules struct {
+	Accounts         map[string]string `json:"accounts"`
+	Regions          map[string]string `json:"regions"`
+	DockerRegistries map[string]string `json:"dockerRegistries"`
+	Applications     map[string]string `json:"applications"`
+}
+
+// migrationProblem is a reference that cannot be resolved in the target.
+type migrationProblem struct {
+	location string
+	kind     string
+	value    string
+	detail   string
+}
+
+// migration holds the applications fetched from the source Spinnaker,
+// rewritten for the target, and the references that cannot be resolved
+// there.
+type migration struct {
+	target   spinnaker.Client
+	set      *appBackupSet
+	rules    migrationRules
+	problems []migrationProblem
+}
+
+// prepareMigration fetches the applications from the source Spinnaker,
+// rewrites them by the rules and checks their references in the target.
+func prepareMigration(cc *cli.Context, clientConfig spinnaker.ClientConfig) (*migration, error) {
+	rules, err := readMigrationRules(cc.String("rules"))
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := clientFromContext(cc, clientConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating spinnaker client")
+	}
+	target, err := targetClientFromContext(cc, clientConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating target spinnaker client")
+	}
+
+	set, err := fetchAppBackup(source, cc.Args())
+	if err != nil {
+		return nil, err
+	}
+	rewriteMigration(set, rules)
+
+	logrus.Info("Checking references in the target")
+	problems, err := preflightMigration(target, set, rules)
+	if err != nil {
+		return nil, err
+	}
+	return &migration{target: target, set: set, rules: rules, problems: problems}, nil
+}
+
+// readMigrationRules reads a YAML or JSON rules file. Without a file no
+// references are rewritten.
+func readMigrationRules(file string) (migrationRules, error) {
+	var rules migrationRules
+	if file == "" {
+		return rules, nil
+	}
+	m, err := readYamlFile(file)
+	if err != nil {
+		return rules, err
+	}
+	for k := range m {
+		switch k {
+		case "accounts", "regions", "dockerRegistries", "applications":
+		default:
+			return rules, fmt.Errorf("unknown rule %q in %s, expected accounts, regions, dockerRegistries or applications", k, file)
+		}
+	}
+	if err := convertMap(m, &rules); err != nil {
+		return rules, errors.Wrapf(err, "decoding rules in %s", file)
+	}
+	return rules, nil
+}
+
+// targetApp returns the name of an application in the target.
+func (r migrationRules) targetApp(app string) string {
+	if target, ok := r.Applications[app]; ok {
+		return target
+	}
+	return app
+}
+
+// rewrite returns a copy of a config with accounts, regions and docker
+// registries renamed. Application names are renamed on restore.
+func (r migrationRules) rewrite(key string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			// Availability zones are keyed by region.
+			if key == "availabilityZones" {
+				if region, ok := r.Regions[k]; ok {
+					m[region] = r.rewrite(key, item)
+					continue
+				}
+			}
+			m[k] = r.rewrite(k, item)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, item := range v {
+			l[i] = r.rewrite(key, item)
+		}
+		return l
+	case string:
+		return r.rewriteString(key, v)
+	}
+	return v
+}
+
+func (r migrationRules) rewriteString(key, s string) string {
+	switch {
+	case isAccountKey(key):
+		if target, ok := r.Accounts[s]; ok {
+			return target
+		}
+	case key == "region" || key == "regions":
+		if target, ok := r.Regions[s]; ok {
+			return target
+		}
+	case key == "availabilityZones":
+		for old, target := range r.Regions {
+			if strings.HasPrefix(s, old) && len(s) == len(old)+1 {
+				return target + s[len(old):]
+			}
+		}
+	}
+	// Images are referred to by registry in many places, such as docker
+	// triggers, bake and manifest stages.
+	for old, target := range r.DockerRegistries {
+		if s == old {
+			return target
+		}
+		if strings.HasPrefix(s, old+"/") {
+			return target + s[len(old):]
+		}
+	}
+	return s
+}
+
+// rewriteMigration applies the rules to the pipelines, strategies and
+// templates of a backup.
+func rewriteMigration(set *appBackupSet, rules migrationRules) {
+	rewriteAll := func(configs []map[string]interface{}) {
+		for i, c := range configs {
+			configs[i] = rules.rewrite("", c).(map[string]interface{})
+		}
+	}
+	for _, a := range set.apps {
+		rewriteAll(a.pipelines)
+		rewriteAll(a.strategies)
+	}
+	rewriteAll(set.templates)
+}
+
+// preflightMigration looks up the accounts, regions, applications and
+// pipelines the rewritten configs refer to, and returns those that do not
+// exist in the target and are not migrated along.
+func preflightMigration(target spinnaker.Client, set *appBackupSet, rules migrationRules) ([]migrationProblem, error) {
+	accounts, err := target.ListAccounts()
+	if err != nil {
+		return nil, errors.Wrap(err, "listing accounts of the target")
+	}
+	regions := map[string]map[string]bool{}
+	for _, a := range accounts {
+		regions[a.Name] = accountRegions(a)
+	}
+
+	migrated := map[string]bool{}
+	pipelineIDs := map[string]bool{}
+	for _, a := range set.apps {
+		migrated[rules.targetApp(a.name)] = true
+		for _, p := range a.pipelines {
+			if id, _ := p["id"].(string); id != "" {
+				pipelineIDs[id] = true
+			}
+		}
+	}
+	apps := map[string]bool{}
+	appExists := func(app string) (bool, error) {
+		if migrated[app] {
+			return true, nil
+		}
+		if exists, ok := apps[app]; ok {
+			return exists, nil
+		}
+		exists, _, err := target.ApplicationGet(app)
+		if err != nil {
+			return false, errors.Wrapf(err, "fetching application %s from the target", app)
+		}
+		apps[app] = exists
+		return exists, nil
+	}
+
+	problems := []migrationProblem{}
+	var check func(location string, v interface{}) error
+	check = func(location string, v interface{}) error {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if err := checkMigrationRefs(location, v, rules, regions, pipelineIDs, appExists, &problems); err != nil {
+				return err
+			}
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if err := check(location+"."+k, v[k]); err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			for i, item := range v {
+				if err := check(fmt.Sprintf("%s[%d]", location, i), item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, a := range set.apps {
+		for _, p := range a.pipelines {
+			if err := check(fmt.Sprintf("%s/%v", a.name, p["name"]), p); err != nil {
+				return nil, err
+			}
+		}
+		for _, s := range a.strategies {
+			if err := check(fmt.Sprintf("%s/strategy/%v", a.name, s["name"]), s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, t := range set.templates {
+		if err := check(fmt.Sprintf("template/%v", t["id"]), t); err != nil {
+			return nil, err
+		}
+	}
+	return problems, nil
+}
+
+// checkMigrationRefs checks the references held directly by a single object
+// of a config.
+func checkMigrationRefs(location string, m map[string]interface{}, rules migrationRules, regions map[string]map[string]bool, pipelineIDs map[string]bool, appExists func(string) (bool, error), problems *[]migrationProblem) error {
+	add := func(kind, value, detail string) {
+		*problems = append(*problems, migrationProblem{location: location, kind: kind, value: value, detail: detail})
+	}
+
+	for _, key := range accountKeys {
+		account, ok := m[key].(string)
+		if !ok || account == "" || isExpression(account) {
+			continue
+		}
+		known, ok := regions[account]
+		if !ok {
+			add("account", account, "no such account in the target, add an accounts rule")
+			continue
+		}
+		if len(known) == 0 {
+			continue
+		}
+		for _, region := range objectRegions(m) {
+			if !known[region] && !isExpression(region) {
+				add("region", region, "account "+account+" has no such region in the target, add a regions rule")
+			}
+		}
+	}
+
+	if app, ok := m["application"].(string); ok && app != "" && !isExpression(app) {
+		target := rules.targetApp(app)
+		exists, err := appExists(target)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			add("application", target, "not migrated and no such application in the target")
+		}
+	}
+
+	// Pipeline triggers and stages refer to other pipelines by id.
+	if m["type"] == "pipeline" {
+		if id, ok := m["pipeline"].(string); ok && id != "" && !isExpression(id) && !pipelineIDs[id] {
+			add("pipeline", id, "the pipeline is not migrated, so its id is unknown in the target")
+		}
+	}
+	return nil
+}
+
+// objectRegions returns the regions an object refers to.
+func objectRegions(m map[string]interface{}) []string {
+	regions := []string{}
+	if region, ok := m["region"].(string); ok && region != "" {
+		regions = append(regions, region)
+	}
+	if list, ok := m["regions"].([]interface{}); ok {
+		for _, r := range list {
+			if region, ok := r.(string); ok {
+				regions = append(regions, region)
+			}
+		}
+	}
+	if zones, ok := m["availabilityZones"].(map[string]interface{}); ok {
+		for region := range zones {
+			regions = append(regions, region)
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// accountRegions returns the names of the regions of an account.
+func accountRegions(account spinnaker.Account) map[string]bool {
+	regions := map[string]bool{}
+	for _, r := range account.Regions {
+		switch r := r.(type) {
+		case string:
+			regions[r] = true
+		case map[string]interface{}:
+			if name, ok := r["name"].(string); ok {
+				regions[name] = true
+				continue
+			}
+			for name := range r {
+				regions[name] = true
+			}
+		}
+	}
+	return regions
+}
+
+func printMigrationProblems(problems []migrationProblem) {
+	if len(problems) == 0 {
+		fmt.Println("All references resolve in the target")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LOCATION\tKIND\tREFERENCE\tPROBLEM")
+	for _, p := range problems {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.location, p.kind, p.value, p.detail)
+	}
+	w.Flush()
+	logrus.WithField("count", len(problems)).Warn("References cannot be resolved in the target")
+}
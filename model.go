@@ -4,13 +4,16 @@ import "github.com/spinnaker/roer/spinnaker"
 
 // PipelineTemplate is a pipeline template
 type PipelineTemplate struct {
-	Schema        string                   `json:"schema"`
-	ID            string                   `json:"id"`
-	Metadata      PipelineTemplateMetadata `json:"metadata"`
-	Protect       bool                     `json:"protect"`
-	Configuration PipelineTemplateConfig   `json:"configuration,omitempty"`
-	Variables     []interface{}            `json:"variables,omitempty"`
-	Stages        []PipelineTemplateStage  `json:"stages"`
+	Schema        string                     `json:"schema"`
+	ID            string                     `json:"id"`
+	Source        string                     `json:"source,omitempty"`
+	Metadata      PipelineTemplateMetadata   `json:"metadata"`
+	Protect       bool                       `json:"protect"`
+	Configuration PipelineTemplateConfig     `json:"configuration,omitempty"`
+	Variables     []PipelineTemplateVariable `json:"variables,omitempty"`
+	Stages        []PipelineTemplateStage    `json:"stages"`
+	Modules       []PipelineTemplateModule   `json:"modules,omitempty"`
+	Partials      []PipelineTemplatePartial  `json:"partials,omitempty"`
 }
 
 // PipelineTemplateMetadata metadata for a template
@@ -21,6 +24,18 @@ type PipelineTemplateMetadata struct {
 	Scopes      []string `json:"scopes,omitempty"`
 }
 
+// PipelineTemplateVariable is a variable declared by a pipeline template, module
+// or partial. Variables without a default value must be set, unless they are
+// nullable.
+type PipelineTemplateVariable struct {
+	Name         string      `json:"name"`
+	Type         string      `json:"type,omitempty"`
+	Description  string      `json:"description,omitempty"`
+	DefaultValue interface{} `json:"defaultValue,omitempty"`
+	Example      interface{} `json:"example,omitempty"`
+	Nullable     bool        `json:"nullable,omitempty"`
+}
+
 // PipelineTemplateConfig pipeline template config
 type PipelineTemplateConfig struct {
 	ConcurrentExecutions map[string]bool          `json:"concurrentExecutions,omitempty"`
@@ -67,19 +82,19 @@ type InheritanceControlRule struct {
 
 // PipelineTemplateModule pipeline template module
 type PipelineTemplateModule struct {
-	ID         string                   `json:"id"`
-	Usage      string                   `json:"usage"`
-	Variables  []map[string]interface{} `json:"variables,omitempty"`
-	When       []string                 `json:"when,omitempty"`
-	Definition map[string]interface{}   `json:"definition"`
+	ID         string                     `json:"id"`
+	Usage      string                     `json:"usage"`
+	Variables  []PipelineTemplateVariable `json:"variables,omitempty"`
+	When       []string                   `json:"when,omitempty"`
+	Definition interface{}                `json:"definition"`
 }
 
 // PipelineTemplatePartial pipeline template partial
 type PipelineTemplatePartial struct {
-	ID        string                   `json:"id"`
-	Usage     string                   `json:"usage"`
-	Variables []map[string]interface{} `json:"variables,omitempty"`
-	Stages    []PipelineTemplateStage  `json:"stages"`
+	ID        string                     `json:"id"`
+	Usage     string                     `json:"usage"`
+	Variables []PipelineTemplateVariable `json:"variables,omitempty"`
+	Stages    []PipelineTemplateStage    `json:"stages"`
 }
 
 // PipelineConfiguration pipeline configuration
@@ -145,3 +160,16 @@ type PipelineConfigurationDefinition struct {
 type TemplateSource struct {
 	Source string `json:"source"`
 }
+
+// templateSource returns the template source of a templated pipeline config,
+// or an empty string for any other pipeline config.
+func templateSource(pipelineConfig spinnaker.PipelineConfig) string {
+	if pipelineConfig.Config == nil {
+		return ""
+	}
+	var configuration PipelineConfiguration
+	if err := convertMap(pipelineConfig.Config, &configuration); err != nil {
+		return ""
+	}
+	return configuration.Pipeline.Template.Source
+}
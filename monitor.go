@@ -0,0 +1,275 @@
+package roer
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// errMonitorTimeout is returned when an execution does not complete within
+// the monitor timeout.
+var errMonitorTimeout = errors.New("timed out waiting for execution to complete")
+
+// errMonitorStopped is returned when a monitor is stopped before the execution
+// completes.
+var errMonitorStopped = errors.New("monitoring stopped")
+
+const (
+	defaultMonitorTimeout = 30 * time.Minute
+	maxRetryBackoff       = 30 * time.Second
+)
+
+// executionMonitor polls a pipeline execution until it completes, handing
+// every observed state to a progressRenderer. Transient failures are retried
+// with exponential backoff, so a monitor that loses its connection reattaches
+// to the same execution.
+type executionMonitor struct {
+	client      spinnaker.Client
+	executionID string
+	interval    time.Duration
+	timeout     time.Duration
+	maxRetries  int
+	renderer    progressRenderer
+}
+
+// newExecutionMonitor configures a monitor from the monitoring flags of a
+// command. The monitor timeout falls back to the global --timeout when only
+// that one has been set.
+func newExecutionMonitor(cc *cli.Context, client spinnaker.Client, executionID string) *executionMonitor {
+	timeout := defaultMonitorTimeout
+	if cc.IsSet("monitor-timeout") {
+		timeout = time.Duration(cc.Int("monitor-timeout")) * time.Second
+	} else if cc.GlobalIsSet("timeout") {
+		timeout = time.Duration(cc.GlobalInt("timeout")) * time.Second
+	}
+
+	interval := time.Duration(cc.Int("poll-interval")) * time.Second
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return &executionMonitor{
+		client:      client,
+		executionID: executionID,
+		interval:    interval,
+		timeout:     timeout,
+		maxRetries:  cc.Int("retry"),
+		renderer:    newProgressRenderer(),
+	}
+}
+
+// run blocks until the execution has completed, the timeout has elapsed or
+// stop is closed. Once stopped it renders nothing more, so the terminal can be
+// used for other output.
+func (m *executionMonitor) run(stop <-chan struct{}) (*spinnaker.PipelineExecution, error) {
+	logrus.WithFields(logrus.Fields{
+		"executionId": m.executionID,
+		"timeout":     m.timeout,
+	}).Info("Waiting for execution to complete...")
+
+	deadline := time.Now().Add(m.timeout)
+	failures := 0
+	var last *spinnaker.PipelineExecution
+
+	for {
+		wait := m.interval
+
+		execution, err := m.client.GetPipelineExecution(m.executionID)
+		select {
+		case <-stop:
+			if err == nil && execution != nil {
+				last = execution
+			}
+			return last, errMonitorStopped
+		default:
+		}
+		switch {
+		case err != nil && spinnaker.IsTransient(err) && failures < m.maxRetries:
+			failures++
+			wait = backoff(m.interval, failures)
+			logrus.WithFields(logrus.Fields{
+				"executionId": m.executionID,
+				"retry":       failures,
+				"wait":        wait,
+			}).WithError(err).Warn("Failed polling execution, reattaching")
+		case err != nil:
+			return last, errors.Wrapf(err, "lost track of execution %s", m.executionID)
+		case execution == nil:
+			return last, notFound("could not find execution %s", m.executionID)
+		default:
+			failures = 0
+			last = execution
+			m.renderer.render(*execution)
+			if execution.Complete() {
+				return execution, nil
+			}
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return last, errMonitorTimeout
+		}
+		if wait > remaining {
+			wait = remaining
+		}
+		select {
+		case <-stop:
+			return last, errMonitorStopped
+		case <-time.After(wait):
+		}
+	}
+}
+
+// backoff returns the wait before the given retry attempt: the poll interval
+// doubled on every attempt, capped, with half of it randomized so that many
+// monitors do not retry in lockstep.
+func backoff(interval time.Duration, attempt int) time.Duration {
+	d := interval
+	for i := 1; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// progressRenderer displays the progress of an execution while it is being
+// monitored.
+type progressRenderer interface {
+	render(execution spinnaker.PipelineExecution)
+}
+
+// newProgressRenderer returns a live redrawing view when stdout is a terminal
+// and an append-only log otherwise, which keeps CI logs readable.
+func newProgressRenderer() progressRenderer {
+	if terminal.IsTerminal(int(os.Stdout.Fd())) {
+		return &ttyRenderer{out: os.Stdout}
+	}
+	return &logRenderer{statuses: map[string]string{}, prompted: map[string]bool{}}
+}
+
+// topLevelStages returns the stages of an execution that were defined by the
+// pipeline, leaving out the synthetic stages Orca adds around them.
+func topLevelStages(execution spinnaker.PipelineExecution) []spinnaker.ExecutionStage {
+	stages := []spinnaker.ExecutionStage{}
+	for _, s := range execution.Stages {
+		if s.ParentStageID == "" {
+			stages = append(stages, s)
+		}
+	}
+	return stages
+}
+
+// ttyRenderer redraws a per-stage timeline in place on every poll.
+type ttyRenderer struct {
+	out   io.Writer
+	lines int
+}
+
+func (r *ttyRenderer) render(execution spinnaker.PipelineExecution) {
+	frame := []string{
+		fmt.Sprintf("%s (%s)  %s  %s", execution.Name, execution.ID, execution.Status, formatDuration(execution.Duration())),
+	}
+
+	stages := topLevelStages(execution)
+	width := 0
+	for _, s := range stages {
+		if len(s.Name) > width {
+			width = len(s.Name)
+		}
+	}
+	for _, s := range stages {
+		frame = append(frame, fmt.Sprintf("  %s %-*s  %-11s  %s", stageMarker(s.Status), width, s.Name, s.Status, formatDuration(s.Duration())))
+	}
+	for _, s := range waitingJudgments(execution) {
+		frame = append(frame, fmt.Sprintf("  %s is waiting for judgment, run: %s", s.Name, judgeCommand(execution.ID, s)))
+	}
+
+	if r.lines > 0 {
+		// Move the cursor back to the start of the previous frame.
+		fmt.Fprintf(r.out, "\033[%dA", r.lines)
+	}
+	for _, line := range frame {
+		fmt.Fprintf(r.out, "\033[2K%s\n", line)
+	}
+	if r.lines > len(frame) {
+		// Clear anything left over from a longer previous frame.
+		for i := len(frame); i < r.lines; i++ {
+			fmt.Fprint(r.out, "\033[2K\n")
+		}
+		fmt.Fprintf(r.out, "\033[%dA", r.lines-len(frame))
+	}
+	r.lines = len(frame)
+}
+
+func stageMarker(status string) string {
+	switch status {
+	case "RUNNING":
+		return "▶"
+	case "SUCCEEDED":
+		return "✔"
+	case "TERMINAL", "CANCELED", "STOPPED", "FAILED_CONTINUE":
+		return "✖"
+	case "PAUSED", "SUSPENDED":
+		return "‖"
+	case "SKIPPED":
+		return "-"
+	}
+	return "·"
+}
+
+// logRenderer logs a line every time a stage changes status, and once for
+// every manual judgment it is waiting on.
+type logRenderer struct {
+	statuses map[string]string
+	prompted map[string]bool
+	status   string
+}
+
+func (r *logRenderer) render(execution spinnaker.PipelineExecution) {
+	for _, s := range topLevelStages(execution) {
+		if r.statuses[s.ID] == s.Status {
+			continue
+		}
+		r.statuses[s.ID] = s.Status
+
+		fields := logrus.Fields{
+			"stage":  s.Name,
+			"status": s.Status,
+		}
+		if s.Status == "RUNNING" {
+			logrus.WithFields(fields).Info("Stage running")
+		} else if s.Status != "NOT_STARTED" {
+			fields["elapsed"] = formatDuration(s.Duration())
+			logrus.WithFields(fields).Info("Stage " + strings.ToLower(s.Status))
+		}
+	}
+
+	for _, s := range waitingJudgments(execution) {
+		if r.prompted[s.ID] {
+			continue
+		}
+		r.prompted[s.ID] = true
+		logrus.WithField("stage", s.Name).Warnf("Waiting for judgment, run: %s", judgeCommand(execution.ID, s))
+	}
+
+	if r.status != execution.Status {
+		r.status = execution.Status
+		logrus.WithFields(logrus.Fields{
+			"pipeline": execution.Name,
+			"status":   execution.Status,
+			"elapsed":  formatDuration(execution.Duration()),
+		}).Info("Execution " + strings.ToLower(execution.Status))
+	}
+}
@@ -0,0 +1,128 @@
+package roer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// pipelineParameter is a single entry of a pipeline's parameterConfig.
+type pipelineParameter struct {
+	Name       string                  `mapstructure:"name"`
+	Required   bool                    `mapstructure:"required"`
+	Default    interface{}             `mapstructure:"default"`
+	HasOptions bool                    `mapstructure:"hasOptions"`
+	Options    []pipelineParameterOpts `mapstructure:"options"`
+}
+
+type pipelineParameterOpts struct {
+	Value interface{} `mapstructure:"value"`
+}
+
+// parseParameters builds the trigger parameters from an optional params file
+// and a list of key=value pairs. Pairs take precedence over the file.
+func parseParameters(paramsFile string, pairs []string) (map[string]interface{}, error) {
+	params := map[string]interface{}{}
+	if paramsFile != "" {
+		fileParams, err := readYamlFile(paramsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading params file")
+		}
+		for k, v := range fileParams {
+			params[k] = v
+		}
+	}
+
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid parameter %q, expected key=value", pair)
+		}
+		params[kv[0]] = kv[1]
+	}
+
+	return params, nil
+}
+
+// parseArtifacts converts --artifact values into artifact maps. A value is
+// either a JSON object or a comma separated list of key=value pairs, such as
+// type=docker/image,name=gcr.io/project/app,reference=gcr.io/project/app:1.0
+func parseArtifacts(values []string) ([]map[string]interface{}, error) {
+	artifacts := []map[string]interface{}{}
+	for _, v := range values {
+		artifact := map[string]interface{}{}
+		if strings.HasPrefix(strings.TrimSpace(v), "{") {
+			if err := json.Unmarshal([]byte(v), &artifact); err != nil {
+				return nil, errors.Wrapf(err, "invalid artifact %q", v)
+			}
+		} else {
+			for _, pair := range strings.Split(v, ",") {
+				kv := strings.SplitN(pair, "=", 2)
+				if len(kv) != 2 || kv[0] == "" {
+					return nil, fmt.Errorf("invalid artifact %q, expected key=value pairs", v)
+				}
+				artifact[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+		}
+		if _, ok := artifact["type"]; !ok {
+			return nil, fmt.Errorf("invalid artifact %q, type is required", v)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
+// validateParameters checks the given parameters against the pipeline's
+// parameterConfig. Required parameters without a default must be supplied
+// and parameters with options must use one of them. Parameters the pipeline
+// does not define are only warned about, as Orca ignores them.
+func validateParameters(pipelineConfig spinnaker.PipelineConfig, params map[string]interface{}) error {
+	var paramConfigs []pipelineParameter
+	if err := mapstructure.Decode(pipelineConfig.Parameters, &paramConfigs); err != nil {
+		return errors.Wrap(err, "decoding pipeline parameter config")
+	}
+
+	known := map[string]bool{}
+	problems := []string{}
+	for _, pc := range paramConfigs {
+		known[pc.Name] = true
+
+		value, ok := params[pc.Name]
+		if !ok || fmt.Sprint(value) == "" {
+			if pc.Required && (pc.Default == nil || fmt.Sprint(pc.Default) == "") {
+				problems = append(problems, fmt.Sprintf("parameter %q is required", pc.Name))
+			}
+			continue
+		}
+
+		if pc.HasOptions && len(pc.Options) > 0 {
+			allowed := []string{}
+			found := false
+			for _, o := range pc.Options {
+				allowed = append(allowed, fmt.Sprint(o.Value))
+				if fmt.Sprint(o.Value) == fmt.Sprint(value) {
+					found = true
+				}
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("parameter %q must be one of [%s], got %q", pc.Name, strings.Join(allowed, ", "), fmt.Sprint(value)))
+			}
+		}
+	}
+
+	for name := range params {
+		if !known[name] {
+			logrus.WithField("parameter", name).Warn("Parameter is not defined by the pipeline and will be ignored")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &invalidParametersError{problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package roer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// Severities of template validation errors, as reported by Orca.
+const (
+	severityFatal = "FATAL"
+	severityWarn  = "WARN"
+)
+
+// decodePlanErrors decodes the body of a failed plan request.
+func decodePlanErrors(body []byte) (*spinnaker.TemplatedPipelineErrorResponse, error) {
+	var resp spinnaker.TemplatedPipelineErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// planFailed reports whether the plan errors include an error of the given
+// severity or worse: any error fails on "warn", only FATAL errors on "fatal".
+func planFailed(resp *spinnaker.TemplatedPipelineErrorResponse, failOn string) bool {
+	var walk func(errs []spinnaker.TemplatedPipelineError) bool
+	walk = func(errs []spinnaker.TemplatedPipelineError) bool {
+		for _, e := range errs {
+			if e.Severity == severityFatal || failOn == "warn" || walk(e.NestedErrors) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(resp.Errors)
+}
+
+// reportPlanErrors reports the findings of a local check before planning.
+// Failures are printed like plan errors and returned as
+// ErrInvalidPipelineTemplate, other findings are logged as warnings.
+func reportPlanErrors(resp *spinnaker.TemplatedPipelineErrorResponse, sources *planSources, failOn string) error {
+	if resp == nil {
+		return nil
+	}
+	if planFailed(resp, failOn) {
+		printPlanErrors(resp, sources)
+		return spinnaker.ErrInvalidPipelineTemplate
+	}
+	for _, e := range resp.Errors {
+		logrus.WithField("location", e.Location).Warn(e.Message)
+	}
+	return nil
+}
+
+// printPlanErrors prints the plan errors grouped by severity, FATAL errors
+// first. Locations in a local file are followed by the file and line number
+// when the sources are known.
+func printPlanErrors(resp *spinnaker.TemplatedPipelineErrorResponse, sources *planSources) {
+	errs := append([]spinnaker.TemplatedPipelineError{}, resp.Errors...)
+	sort.SliceStable(errs, func(i, j int) bool {
+		return severityRank(errs[i].Severity) < severityRank(errs[j].Severity)
+	})
+
+	counts := map[string]int{}
+	for _, e := range errs {
+		counts[e.Severity]++
+	}
+	fmt.Printf("%s: %d fatal, %d warnings\n", resp.Message, counts[severityFatal], counts[severityWarn])
+	for _, e := range errs {
+		fmt.Println()
+		printPlanError(e, sources, "")
+	}
+}
+
+func printPlanError(e spinnaker.TemplatedPipelineError, sources *planSources, indent string) {
+	severity := e.Severity
+	if severity == "" {
+		severity = "ERROR"
+	}
+	fmt.Printf("%s%-5s %s\n", indent, severity, e.Location)
+	indent += "  "
+	if at := sources.resolve(e.Location); at != "" {
+		fmt.Printf("%sat %s\n", indent, at)
+	}
+	if e.Message != "" {
+		fmt.Printf("%s%s\n", indent, e.Message)
+	}
+	if e.Suggestion != "" {
+		fmt.Printf("%sSuggestion: %s\n", indent, e.Suggestion)
+	}
+	if e.Cause != "" {
+		fmt.Printf("%sCause: %s\n", indent, e.Cause)
+	}
+	if len(e.Detail) > 0 {
+		keys := []string{}
+		for k := range e.Detail {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Printf("%sDetail:\n", indent)
+		for _, k := range keys {
+			fmt.Printf("%s  %s: %s\n", indent, k, e.Detail[k])
+		}
+	}
+	for _, n := range e.NestedErrors {
+		printPlanError(n, sources, indent)
+	}
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case severityFatal:
+		return 0
+	case severityWarn:
+		return 1
+	}
+	return 2
+}
+
+// planSources are the local files a plan was made from, used to map error
+// locations such as "configuration:stages.wait" back to a line in the file.
+type planSources struct {
+	files map[string]sourceFile
+}
+
+type sourceFile struct {
+	path  string
+	lines []string
+}
+
+// newPlanSources reads the configuration and, if given, the template file.
+// Files that cannot be read are left out: they only make the report less
+// precise.
+func newPlanSources(configFile, templateFile string) *planSources {
+	s := &planSources{files: map[string]sourceFile{}}
+	for prefix, path := range map[string]string{"configuration": configFile, "template": templateFile} {
+		if path == "" {
+			continue
+		}
+		dat, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		s.files[prefix] = sourceFile{path: path, lines: strings.Split(string(dat), "\n")}
+	}
+	return s
+}
+
+// resolve maps an error location to file:line, or to the file alone when no
+// line matches. Locations are dotted paths into the document, where list
+// items are addressed by their id or name; matching lines are searched in
+// order, each after the previous match.
+func (s *planSources) resolve(location string) string {
+	if s == nil {
+		return ""
+	}
+	parts := strings.SplitN(location, ":", 2)
+	f, ok := s.files[parts[0]]
+	if !ok {
+		return ""
+	}
+	if len(parts) < 2 || parts[1] == "" {
+		return f.path
+	}
+
+	line := -1
+	for _, segment := range strings.Split(parts[1], ".") {
+		found := f.find(segment, line+1)
+		if found < 0 {
+			break
+		}
+		line = found
+	}
+	if line < 0 {
+		return f.path
+	}
+	return fmt.Sprintf("%s:%d", f.path, line+1)
+}
+
+// find returns the index of the first line from start declaring the key, or
+// the list item whose id or name is the key.
+func (f sourceFile) find(key string, start int) int {
+	q := regexp.QuoteMeta(key)
+	re := regexp.MustCompile(`^\s*(-\s+)?(["']?` + q + `["']?\s*:|(id|name|refId)\s*:\s*["']?` + q + `["']?\s*$)`)
+	for i := start; i < len(f.lines); i++ {
+		if re.MatchString(f.lines[i]) {
+			return i
+		}
+	}
+	return -1
+}
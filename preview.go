@@ -0,0 +1,243 @@
+package roer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// Outcomes of planning a dependent pipeline against a local template.
+const (
+	previewBroken     = "BREAKS"
+	previewChanged    = "CHANGES"
+	previewUnchanged  = "UNCHANGED"
+	previewUnverified = "UNVERIFIED"
+	previewSkipped    = "SKIPPED"
+)
+
+// dependentPreview is the result of planning a dependent pipeline against the
+// local version of a template, and optionally the published version.
+type dependentPreview struct {
+	pipeline spinnaker.PipelineConfig
+	outcome  string
+	reason   string
+	planErr  []byte
+	diff     string
+}
+
+// previewDependents plans every pipeline depending on the template against the
+// local version of the template. With withDiff set, each pipeline is also
+// planned against the published template and the planned pipelines are
+// compared.
+//
+// The template source of each pipeline is resolved with the local template
+// substituted for the published one, along with any template the resolver
+// already substitutes, and the merged template is planned inline. Pipelines
+// inheriting the template through a child template are thus planned against
+// the child merged with the local template. Pipelines whose template chain
+// cannot be resolved locally, such as chains with http(s) sources, or that
+// cannot be planned for other reasons than plan errors, are reported as
+// unverified and left to the plan Spinnaker runs when publishing.
+func previewDependents(client spinnaker.Client, resolver *templateResolver, template map[string]interface{}, withDiff bool) ([]dependentPreview, error) {
+	templateID, _ := template["id"].(string)
+	if templateID == "" {
+		return nil, errors.New("template has no id")
+	}
+	resolver.substitute(templateID, template)
+
+	dependents, err := client.ListTemplateDependents(templateID, true)
+	if err != nil {
+		if re, ok := errors.Cause(err).(*spinnaker.ResponseError); ok && re.StatusCode == 404 {
+			// A template that has never been published has no dependents.
+			return []dependentPreview{}, nil
+		}
+		return nil, errors.Wrap(err, "fetching pipeline template dependents")
+	}
+
+	resolved := map[string]map[string]interface{}{}
+	previews := []dependentPreview{}
+	for _, d := range dependents {
+		p := dependentPreview{pipeline: d}
+		logrus.WithFields(logrus.Fields{
+			"application": d.Application,
+			"pipeline":    d.Name,
+		}).Debug("Planning dependent pipeline")
+
+		var config map[string]interface{}
+		if err := convertMap(d.Config, &config); err != nil || config == nil {
+			p.outcome = previewSkipped
+			p.reason = "pipeline has no template configuration"
+			previews = append(previews, p)
+			continue
+		}
+
+		source := templateSource(d)
+		merged, ok := resolved[source]
+		if !ok {
+			if merged, err = resolveDependentTemplate(resolver, source); err != nil {
+				logrus.WithError(err).WithField("source", source).Debug("Could not resolve dependent template")
+				p.outcome = previewUnverified
+				p.reason = "template chain does not resolve locally: " + err.Error()
+				previews = append(previews, p)
+				continue
+			}
+			resolved[source] = merged
+		}
+		if source != "spinnaker://"+templateID {
+			p.reason = "inherits the template through " + source
+		}
+
+		// Configurations whose variables no longer match the template are
+		// broken without asking Orca.
+		if resp, err := checkConfigurationVariables(merged, config); err == nil && resp != nil && planFailed(resp, "fatal") {
+			p.outcome = previewBroken
+			if p.planErr, err = json.Marshal(resp); err != nil {
+				return nil, err
+			}
+			previews = append(previews, p)
+			continue
+		}
+
+		after, err := client.Plan(config, merged)
+		if err != nil {
+			if err == spinnaker.ErrInvalidPipelineTemplate {
+				p.outcome = previewBroken
+				p.planErr = after
+			} else {
+				p.outcome = previewUnverified
+				p.reason = "planning failed: " + err.Error()
+			}
+			previews = append(previews, p)
+			continue
+		}
+
+		p.outcome = previewUnchanged
+		if withDiff {
+			before, err := client.Plan(config, nil)
+			switch {
+			case err == spinnaker.ErrInvalidPipelineTemplate:
+				p.outcome = previewChanged
+				p.reason = "does not plan against the published template"
+			case err != nil:
+				p.outcome = previewUnverified
+				p.reason = "planning against the published template failed: " + err.Error()
+			default:
+				p.diff, err = planDiff(before, after)
+				if err != nil {
+					return nil, errors.Wrapf(err, "comparing plans of %s/%s", d.Application, d.Name)
+				}
+				if p.diff != "" {
+					p.outcome = previewChanged
+				}
+			}
+		}
+		previews = append(previews, p)
+	}
+
+	return previews, nil
+}
+
+// resolveDependentTemplate resolves the template source of a dependent
+// pipeline to the merged template to plan it with.
+func resolveDependentTemplate(resolver *templateResolver, source string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(source, "spinnaker://") {
+		return nil, fmt.Errorf("unsupported template source %q", source)
+	}
+	template, location, err := resolver.load(source, "")
+	if err != nil {
+		return nil, err
+	}
+	merged, _, err := resolver.resolve(template, location)
+	return merged, err
+}
+
+// planDiff returns the diff between two planned pipelines, ignoring values
+// generated anew on every plan.
+func planDiff(before, after []byte) (string, error) {
+	from, err := normalizePlan(before)
+	if err != nil {
+		return "", err
+	}
+	to, err := normalizePlan(after)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff("published", "local", from, to), nil
+}
+
+// countDependents counts the previewed pipelines with the given outcome.
+func countDependents(previews []dependentPreview, outcome string) int {
+	n := 0
+	for _, p := range previews {
+		if p.outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+// brokenDependents counts the previewed pipelines that fail to plan.
+func brokenDependents(previews []dependentPreview) int {
+	return countDependents(previews, previewBroken)
+}
+
+// unverifiedDependents counts the previewed pipelines that could not be
+// planned locally.
+func unverifiedDependents(previews []dependentPreview) int {
+	return countDependents(previews, previewUnverified)
+}
+
+// confirmDependents asks for confirmation before publishing a template that
+// breaks dependent pipelines. Dependents that could not be planned locally do
+// not block the publish: Spinnaker plans the dependents of a template itself
+// when publishing, unless that plan is skipped to publish despite broken
+// dependents.
+func confirmDependents(previews []dependentPreview) error {
+	broken, unverified := brokenDependents(previews), unverifiedDependents(previews)
+	if broken == 0 && unverified == 0 {
+		return nil
+	}
+	printPreview(previews)
+	if broken == 0 {
+		logrus.WithField("count", unverified).Warn("Dependent pipelines could not be planned locally, leaving them to Spinnaker's plan")
+		return nil
+	}
+
+	question := fmt.Sprintf("%d dependent pipelines fail to plan against this template. Publish anyway?", broken)
+	if unverified > 0 {
+		question = fmt.Sprintf("%d dependent pipelines fail to plan against this template and %d could not be planned, which Spinnaker will not plan either. Publish anyway?", broken, unverified)
+	}
+	if !confirm(question) {
+		return errors.Wrapf(spinnaker.ErrInvalidPipelineTemplate, "%d dependent pipelines fail to plan", broken)
+	}
+	return nil
+}
+
+func printPreview(previews []dependentPreview) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "APPLICATION\tPIPELINE\tRESULT\tDETAIL")
+	for _, p := range previews {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.pipeline.Application, p.pipeline.Name, p.outcome, p.reason)
+	}
+	w.Flush()
+
+	for _, p := range previews {
+		switch {
+		case p.outcome == previewBroken:
+			fmt.Printf("\n%s/%s fails to plan:\n", p.pipeline.Application, p.pipeline.Name)
+			if planErrors, err := decodePlanErrors(p.planErr); err == nil {
+				printPlanErrors(planErrors, nil)
+			} else {
+				prettyPrintJSON(p.planErr)
+			}
+		case p.diff != "":
+			fmt.Printf("\n%s/%s:\n%s", p.pipeline.Application, p.pipeline.Name, p.diff)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package roer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// Outcomes of publishing a template of a batch.
+const (
+	publishPublished = "PUBLISHED"
+	publishPreviewed = "PREVIEWED"
+	publishFailed    = "FAILED"
+	publishSkipped   = "SKIPPED"
+)
+
+// batchTemplate is a template file to publish as part of a batch, along with
+// the files of its parents in the same batch.
+type batchTemplate struct {
+	file    string
+	id      string
+	parents []string
+}
+
+// publishResult is the outcome of publishing a template of a batch.
+type publishResult struct {
+	template batchTemplate
+	outcome  string
+	detail   string
+}
+
+// expandTemplateFiles expands the publish arguments to template files.
+// Arguments can be files, glob patterns or directories; directories are
+// searched recursively for templates, skipping pipeline configurations and
+// other files.
+func expandTemplateFiles(args []string) ([]string, error) {
+	files := []string{}
+	seen := map[string]bool{}
+	add := func(path string) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			files = append(files, path)
+		}
+		return nil
+	}
+
+	for _, arg := range args {
+		paths := []string{arg}
+		glob := strings.ContainsAny(arg, "*?[")
+		if glob {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, errors.Wrapf(err, "expanding %s", arg)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no templates match %s", arg)
+			}
+			paths = matches
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				// Glob patterns often match configurations next to templates.
+				if glob && !isTemplateFile(path) {
+					continue
+				}
+				if err := add(path); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			found, err := findTemplateFiles(path)
+			if err != nil {
+				return nil, err
+			}
+			if len(found) == 0 {
+				return nil, fmt.Errorf("no templates found in %s", path)
+			}
+			for _, f := range found {
+				if err := add(f); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+// findTemplateFiles returns the pipeline templates in a directory tree.
+func findTemplateFiles(dir string) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && isTemplateFile(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "searching %s for templates", dir)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// isTemplateFile reports whether a file holds a pipeline template, rather than
+// a pipeline configuration or anything else.
+func isTemplateFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml", ".json":
+	default:
+		return false
+	}
+	m, err := readYamlFile(path)
+	if err != nil {
+		logrus.WithError(err).WithField("file", path).Debug("Skipping unreadable file")
+		return false
+	}
+	return isPipelineTemplate(m)
+}
+
+// isPipelineTemplate reports whether a decoded file is a pipeline template. A
+// template has an id, a schema and metadata or variables. Configurations have
+// a pipeline section, and exported pipelines an application and stages.
+func isPipelineTemplate(m map[string]interface{}) bool {
+	if id, _ := m["id"].(string); id == "" {
+		return false
+	}
+	if _, ok := m["schema"]; !ok {
+		return false
+	}
+	_, hasMetadata := m["metadata"]
+	_, hasVariables := m["variables"]
+	if !hasMetadata && !hasVariables {
+		return false
+	}
+	if _, isConfig := m["pipeline"]; isConfig {
+		return false
+	}
+	_, hasApplication := m["application"]
+	_, hasStages := m["stages"]
+	return !(hasApplication && hasStages)
+}
+
+// orderTemplateFiles reads the template files and orders them so parents are
+// published before the children referring to them by source. Parents can be
+// referred to by local path or by spinnaker:// id. Files without a
+// dependency between them keep their order.
+func orderTemplateFiles(files []string) ([]batchTemplate, error) {
+	templates := make([]batchTemplate, len(files))
+	sources := make([]string, len(files))
+	byPath := map[string]string{}
+	byID := map[string]string{}
+	for i, file := range files {
+		m, err := readYamlFile(file)
+		if err != nil {
+			return nil, err
+		}
+		id, _ := m["id"].(string)
+		if id == "" {
+			return nil, fmt.Errorf("template %s has no id", file)
+		}
+		if existing, ok := byID[id]; ok {
+			return nil, fmt.Errorf("template %s is defined in both %s and %s", id, existing, file)
+		}
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		byID[id] = file
+		byPath[abs] = file
+		templates[i] = batchTemplate{file: file, id: id}
+		sources[i], _ = m["source"].(string)
+	}
+
+	for i, t := range templates {
+		source := sources[i]
+		var parent string
+		if isLocalSource(source) {
+			path := strings.TrimPrefix(source, "file://")
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(t.file), path)
+			}
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return nil, err
+			}
+			parent = byPath[abs]
+		} else if strings.HasPrefix(source, "spinnaker://") {
+			parent = byID[strings.TrimPrefix(source, "spinnaker://")]
+		}
+		if parent != "" {
+			templates[i].parents = []string{parent}
+		}
+	}
+
+	ordered := []batchTemplate{}
+	placed := map[string]bool{}
+	for len(ordered) < len(templates) {
+		progress := false
+		for _, t := range templates {
+			if placed[t.file] {
+				continue
+			}
+			ready := true
+			for _, p := range t.parents {
+				ready = ready && placed[p]
+			}
+			if ready {
+				placed[t.file] = true
+				ordered = append(ordered, t)
+				progress = true
+			}
+		}
+		if !progress {
+			cycle := []string{}
+			for _, t := range templates {
+				if !placed[t.file] {
+					cycle = append(cycle, t.file)
+				}
+			}
+			return nil, fmt.Errorf("template source cycle between %s", strings.Join(cycle, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// publishTemplateBatch publishes templates in order, waiting for each publish
+// task. It stops at the first failure, unless --continue-on-error is set, in
+// which case only the children of failed templates are skipped.
+//
+// Templates are published parents first, so the dependents of a child are
+// planned against its published parent. With --preview nothing is published,
+// so every template of the batch is substituted for its published version
+// when planning dependents.
+func publishTemplateBatch(cc *cli.Context, client spinnaker.Client, batch []batchTemplate) error {
+	resolver := newTemplateResolver(nil, client)
+	templates := map[string]map[string]interface{}{}
+	readErrs := map[string]error{}
+	for _, t := range batch {
+		template, err := readPublishTemplate(cc, t.file)
+		if err != nil {
+			readErrs[t.file] = err
+			continue
+		}
+		templates[t.file] = template
+		if cc.Bool("preview") {
+			resolver.substitute(t.id, template)
+		}
+	}
+
+	results := []publishResult{}
+	notPublished := map[string]string{}
+	var firstErr error
+	for _, t := range batch {
+		result := publishResult{template: t}
+		parentFailed := ""
+		for _, p := range t.parents {
+			if _, ok := notPublished[p]; ok {
+				parentFailed = p
+			}
+		}
+
+		switch {
+		case firstErr != nil && !cc.Bool("continue-on-error"):
+			result.outcome = publishSkipped
+			result.detail = "not published after an earlier failure"
+		case parentFailed != "":
+			result.outcome = publishSkipped
+			result.detail = "parent " + notPublished[parentFailed] + " was not published"
+		default:
+			logrus.WithFields(logrus.Fields{
+				"file":       t.file,
+				"templateId": t.id,
+			}).Info("Publishing template from batch")
+			err := readErrs[t.file]
+			if err == nil {
+				err = publishTemplate(cc, client, resolver, templates[t.file])
+			}
+			if err != nil {
+				result.outcome = publishFailed
+				result.detail = err.Error()
+				if firstErr == nil {
+					firstErr = err
+				}
+			} else if cc.Bool("preview") {
+				result.outcome = publishPreviewed
+			} else {
+				result.outcome = publishPublished
+			}
+		}
+		if result.outcome != publishPublished && result.outcome != publishPreviewed {
+			notPublished[t.file] = t.id
+		}
+		results = append(results, result)
+	}
+
+	printPublishSummary(results)
+	if firstErr != nil {
+		return errors.Wrapf(firstErr, "%d of %d templates were not published", len(notPublished), len(batch))
+	}
+	return nil
+}
+
+func printPublishSummary(results []publishResult) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TEMPLATE\tFILE\tRESULT\tDETAIL")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.template.id, r.template.file, r.outcome, r.detail)
+	}
+	w.Flush()
+}
@@ -4,8 +4,16 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
 )
 
 func prettyPrintJSON(j []byte) {
@@ -17,3 +25,83 @@ func prettyPrintJSON(j []byte) {
 	}
 	fmt.Println(string(pretty.Bytes()))
 }
+
+// writeOutput writes dat to the file at path, or to stdout when no path is
+// given.
+func writeOutput(path string, dat []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(dat)
+		return err
+	}
+	if err := ioutil.WriteFile(path, dat, 0644); err != nil {
+		return errors.Wrapf(err, "writing %s", path)
+	}
+	logrus.WithField("file", path).Info("Wrote file")
+	return nil
+}
+
+// marshalOutput marshals v as YAML or JSON, as selected by an --output flag.
+func marshalOutput(v interface{}, format string) ([]byte, error) {
+	switch format {
+	case "", "yaml", "yml":
+		return yaml.Marshal(v)
+	case "json":
+		dat, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(dat, '\n'), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, expected yaml or json", format)
+}
+
+func printExecutionList(executions []spinnaker.PipelineExecution) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPIPELINE\tSTATUS\tTRIGGER\tSTARTED\tDURATION")
+	for _, e := range executions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.ID, e.Name, e.Status, e.Trigger.Type, formatTimestamp(e.StartTime), formatDuration(e.Duration()))
+	}
+	w.Flush()
+}
+
+func formatTimestamp(ms int64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)).Local().Format("2006-01-02 15:04:05")
+}
+
+func formatRFC3339(ms int64) string {
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Truncate(time.Second).String()
+}
+
+func printTemplateList(templates []PipelineTemplate) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tOWNER\tSCOPES\tSOURCE")
+	for _, t := range templates {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			t.ID, t.Metadata.Name, t.Metadata.Owner, strings.Join(t.Metadata.Scopes, ","), t.Source)
+	}
+	w.Flush()
+}
+
+func printDependentList(templateID string, dependents []spinnaker.PipelineConfig) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "APPLICATION\tPIPELINE\tID\tTEMPLATE")
+	for _, d := range dependents {
+		source := templateSource(d)
+		if source == "spinnaker://"+templateID {
+			source = "direct"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Application, d.Name, d.ID, source)
+	}
+	w.Flush()
+}
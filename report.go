@@ -0,0 +1,216 @@
+package roer
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// reportTarget is a single --report flag value, such as junit=build/deploy.xml
+type reportTarget struct {
+	format string
+	path   string
+}
+
+// parseReports validates --report flag values up front, so a typo does not
+// surface only after a long execution has completed.
+func parseReports(values []string) ([]reportTarget, error) {
+	reports := []reportTarget{}
+	for _, v := range values {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("invalid report %q, expected format=path", v)
+		}
+		switch kv[0] {
+		case "junit", "json":
+		default:
+			return nil, fmt.Errorf("invalid report format %q, expected junit or json", kv[0])
+		}
+		reports = append(reports, reportTarget{format: kv[0], path: kv[1]})
+	}
+	return reports, nil
+}
+
+// writeReports writes a report of the execution for every target.
+func writeReports(reports []reportTarget, execution spinnaker.PipelineExecution) error {
+	for _, r := range reports {
+		var dat []byte
+		var err error
+		switch r.format {
+		case "junit":
+			dat, err = xml.MarshalIndent(newJUnitReport(execution), "", "  ")
+			dat = append(append([]byte(xml.Header), dat...), '\n')
+		case "json":
+			dat, err = json.MarshalIndent(newExecutionReport(execution), "", "  ")
+			dat = append(dat, '\n')
+		}
+		if err != nil {
+			return errors.Wrapf(err, "marshaling %s report", r.format)
+		}
+
+		if err := ioutil.WriteFile(r.path, dat, 0644); err != nil {
+			return errors.Wrapf(err, "writing %s report", r.format)
+		}
+		logrus.WithField("file", r.path).Infof("Wrote %s report", r.format)
+	}
+	return nil
+}
+
+// executionReport is the JSON report of an execution.
+type executionReport struct {
+	ID          string                     `json:"id"`
+	Name        string                     `json:"name"`
+	Application string                     `json:"application"`
+	Status      string                     `json:"status"`
+	StartTime   int64                      `json:"startTime,omitempty"`
+	EndTime     int64                      `json:"endTime,omitempty"`
+	Duration    float64                    `json:"durationSeconds"`
+	Trigger     spinnaker.ExecutionTrigger `json:"trigger"`
+	Stages      []stageReport              `json:"stages"`
+}
+
+type stageReport struct {
+	RefID     string                           `json:"refId"`
+	Name      string                           `json:"name"`
+	Type      string                           `json:"type"`
+	Status    string                           `json:"status"`
+	StartTime int64                            `json:"startTime,omitempty"`
+	EndTime   int64                            `json:"endTime,omitempty"`
+	Duration  float64                          `json:"durationSeconds"`
+	Exception *spinnaker.RetrofitErrorResponse `json:"exception,omitempty"`
+}
+
+func newExecutionReport(execution spinnaker.PipelineExecution) executionReport {
+	report := executionReport{
+		ID:          execution.ID,
+		Name:        execution.Name,
+		Application: execution.Application,
+		Status:      execution.Status,
+		StartTime:   execution.StartTime,
+		EndTime:     execution.EndTime,
+		Duration:    execution.Duration().Seconds(),
+		Trigger:     execution.Trigger,
+		Stages:      []stageReport{},
+	}
+	for _, s := range topLevelStages(execution) {
+		report.Stages = append(report.Stages, stageReport{
+			RefID:     s.RefID,
+			Name:      s.Name,
+			Type:      s.Type,
+			Status:    s.Status,
+			StartTime: s.StartTime,
+			EndTime:   s.EndTime,
+			Duration:  s.Duration().Seconds(),
+			Exception: s.ExtractException(),
+		})
+	}
+	return report
+}
+
+// The JUnit XML report turns the execution into a test suite with a test case
+// per stage, which CI servers can display natively.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+func newJUnitReport(execution spinnaker.PipelineExecution) junitTestSuites {
+	suite := junitTestSuite{
+		Name: fmt.Sprintf("%s.%s", execution.Application, execution.Name),
+		Time: fmt.Sprintf("%.3f", execution.Duration().Seconds()),
+	}
+	if execution.StartTime > 0 {
+		suite.Timestamp = formatRFC3339(execution.StartTime)
+	}
+
+	for _, s := range topLevelStages(execution) {
+		tc := junitTestCase{
+			Name:      s.Name,
+			ClassName: suite.Name,
+			Time:      fmt.Sprintf("%.3f", s.Duration().Seconds()),
+		}
+		switch {
+		case s.Status == "SUCCEEDED":
+		case s.Status == "NOT_STARTED" || s.Status == "SKIPPED":
+			tc.Skipped = &junitSkipped{Message: s.Status}
+			suite.Skipped++
+		case !execution.Complete() && (s.Status == "RUNNING" || s.Status == "PAUSED"):
+			tc.Skipped = &junitSkipped{Message: "stage had not completed: " + s.Status}
+			suite.Skipped++
+		default:
+			tc.Failure = stageFailure(s)
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Tests = len(suite.TestCases)
+
+	return junitTestSuites{Suites: []junitTestSuite{suite}}
+}
+
+// stageFailure describes a failed stage using the exception details Orca
+// recorded for it.
+func stageFailure(stage spinnaker.ExecutionStage) *junitFailure {
+	failure := &junitFailure{
+		Message: fmt.Sprintf("stage ended with status %s", stage.Status),
+		Type:    stage.Status,
+	}
+
+	exception := stage.ExtractException()
+	if exception == nil {
+		return failure
+	}
+
+	if exception.Error != "" {
+		failure.Message = exception.Error
+	}
+	lines := append([]string{}, exception.Errors...)
+	if exception.Status != 0 {
+		lines = append(lines, fmt.Sprintf("status: %d", exception.Status))
+	}
+	if exception.URL != "" {
+		lines = append(lines, "url: "+exception.URL)
+	}
+	if exception.Kind != "" {
+		lines = append(lines, "kind: "+exception.Kind)
+	}
+	if exception.ResponseBody != "" {
+		lines = append(lines, "response: "+exception.ResponseBody)
+	}
+	failure.Body = strings.Join(lines, "\n")
+	return failure
+}
@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 	"time"
 
 	"strconv"
@@ -18,12 +20,20 @@ var (
 	// ErrInvalidPipelineTemplate is returned when a plan or run fails due to an
 	// invalid template or configuration.
 	ErrInvalidPipelineTemplate = errors.New("pipeline template is invalid")
+
+	// ErrTaskTimeout is returned when a polled task does not complete within
+	// the given timeout.
+	ErrTaskTimeout = errors.New("timed out waiting for task to complete")
 )
 
 // ClientConfig is used to initialize the Client
 type ClientConfig struct {
 	HTTPClientFactory HTTPClientFactory
 	Endpoint          string
+	// TargetHTTPClientFactory creates the client for the target Spinnaker
+	// of commands that talk to two Spinnaker installations, whose endpoint
+	// is given per command.
+	TargetHTTPClientFactory HTTPClientFactory
 }
 
 // Client is the Spinnaker API client
@@ -35,7 +45,7 @@ type Client interface {
 	ApplicationList() ([]ApplicationInfo, error)
 	Plan(configuration map[string]interface{}, template map[string]interface{}) ([]byte, error)
 	DeleteTemplate(templateID string) (*TaskRefResponse, error)
-	ExecPipeline(appName string, pipeline string) (*TaskRefResponse, error)
+	ExecPipeline(appName string, pipeline string, trigger ExecutionTrigger) (*TaskRefResponse, error)
 	// Run(configuration interface{}) ([]byte, error)
 	GetTask(refURL string) (*ExecutionResponse, error)
 	PollTaskStatus(refURL string, timeout time.Duration) (*ExecutionResponse, error)
@@ -44,6 +54,25 @@ type Client interface {
 	ListPipelineConfigs(app string) ([]PipelineConfig, error)
 	DeletePipeline(app, pipelineConfigID string) error
 	FiatLogin(fiatUser string, fiatPass string) error
+	ListPipelineExecutions(app string, options ListExecutionsOptions) ([]PipelineExecution, error)
+	GetPipelineExecution(executionID string) (*PipelineExecution, error)
+	CancelPipelineExecution(executionID string, reason string) error
+	PausePipelineExecution(executionID string) error
+	ResumePipelineExecution(executionID string) error
+	JudgeStage(executionID string, stageID string, judgment ManualJudgment) error
+	RestartStage(executionID string, stageID string) error
+	ListTemplates(scopes []string) ([]map[string]interface{}, error)
+	GetTemplate(templateID string) (map[string]interface{}, error)
+	ListTemplateDependents(templateID string, recursive bool) ([]PipelineConfig, error)
+	// GetPipelineConfigMap, ListPipelineConfigMaps and SavePipelineConfigMap
+	// keep every field of a pipeline config, including those PipelineConfig
+	// does not model.
+	GetPipelineConfigMap(app, pipelineConfigID string) (map[string]interface{}, error)
+	ListPipelineConfigMaps(app string) ([]map[string]interface{}, error)
+	SavePipelineConfigMap(pipelineConfig map[string]interface{}) error
+	ListStrategyConfigs(app string) ([]map[string]interface{}, error)
+	SaveStrategyConfig(strategyConfig map[string]interface{}) error
+	ListAccounts() ([]Account, error)
 }
 
 type client struct {
@@ -72,6 +101,14 @@ func (c *client) pipelineConfigURL(app, pipelineConfigID string) string {
 	return c.pipelineConfigsURL(app) + "/" + pipelineConfigID
 }
 
+func (c *client) strategyConfigsURL(app string) string {
+	return c.endpoint + fmt.Sprintf("/applications/%s/strategyConfigs", app)
+}
+
+func (c *client) strategiesURL() string {
+	return c.endpoint + "/strategies"
+}
+
 func (c *client) pipelinesURL() string {
 	return c.endpoint + "/pipelines"
 }
@@ -92,27 +129,28 @@ func (c *client) pipelineURL(app string, pipelineID string) string {
 	return fmt.Sprintf("%s/pipelines/%s/%s", c.endpoint, app, pipelineID)
 }
 
+func (c *client) applicationPipelinesURL(app string) string {
+	return c.endpoint + fmt.Sprintf("/applications/%s/pipelines", app)
+}
+
+func (c *client) pipelineExecutionURL(executionID string) string {
+	return c.endpoint + "/pipelines/" + executionID
+}
+
+func (c *client) credentialsURL() string {
+	return c.endpoint + "/credentials?expand=true"
+}
+
 func (c *client) fiatLoginURL() string {
 	return c.endpoint + "/login"
 }
 
 func (c *client) templateExists(id string) (bool, error) {
-	url := c.pipelineTemplatesURL() + "/" + id
-	resp, _, err := c.getJSON(url)
-
+	template, err := c.GetTemplate(id)
 	if err != nil {
 		return false, err
 	}
-
-	logrus.WithField("status", resp.StatusCode).Debug("Response")
-
-	if resp.StatusCode == http.StatusNotFound {
-		return false, nil
-	}
-	if resp.StatusCode == http.StatusOK {
-		return true, nil
-	}
-	return false, errors.New("Unable to determine state of the pipeline template " + id + ", status: " + strconv.Itoa(resp.StatusCode))
+	return template != nil, nil
 }
 
 // PublishTemplateOptions options for publishing templates
@@ -155,7 +193,7 @@ func (c *client) PublishTemplate(template map[string]interface{}, options Publis
 	}).Debug("Response")
 
 	if resp.StatusCode != http.StatusAccepted {
-		return nil, errors.New("create template request failed")
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "create template request failed")
 	}
 
 	var ref TaskRefResponse
@@ -180,7 +218,7 @@ func (c *client) ApplicationSubmitTask(app string, task Task) (*TaskRefResponse,
 	}).Debug("Response")
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("submit task failed")
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "submit task failed")
 	}
 
 	var ref TaskRefResponse
@@ -208,7 +246,7 @@ func (c *client) ApplicationGet(app string) (bool, []byte, error) {
 		return false, nil, nil
 	}
 	if resp.StatusCode != http.StatusOK {
-		return false, nil, errors.New("Unable to determine state of application " + app + ", status: " + strconv.Itoa(resp.StatusCode))
+		return false, nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "Unable to determine state of application "+app)
 	}
 
 	return true, respBody, nil
@@ -228,7 +266,7 @@ func (c *client) ApplicationList() ([]ApplicationInfo, error) {
 	}).Debug("Response")
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("Unable to fetch application list: " + strconv.Itoa(resp.StatusCode))
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "Unable to fetch application list")
 	}
 
 	var appInfo []ApplicationInfo
@@ -262,7 +300,7 @@ func (c *client) Plan(configuration map[string]interface{}, template map[string]
 		if resp.StatusCode == http.StatusBadRequest {
 			return respBody, ErrInvalidPipelineTemplate
 		}
-		return respBody, errors.New("plan request failed")
+		return respBody, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: c.startPipelineURL()}, "plan request failed")
 	}
 
 	return respBody, nil
@@ -282,7 +320,7 @@ func (c *client) DeleteTemplate(templateID string) (*TaskRefResponse, error) {
 	}).Debug("Response")
 
 	if resp.StatusCode != http.StatusAccepted {
-		return nil, errors.New("delete request failed")
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "delete request failed")
 	}
 
 	var ref TaskRefResponse
@@ -317,7 +355,7 @@ func (c *client) GetTask(refURL string) (*ExecutionResponse, error) {
 	}).Debug("Response")
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("get task status failed")
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: refURL}, "get task status failed")
 	}
 
 	var task ExecutionResponse
@@ -347,7 +385,7 @@ func (c *client) PollTaskStatus(refURL string, timeout time.Duration) (*Executio
 
 		select {
 		case <-timer.C:
-			return nil, errors.New("timed out waiting for task to complete")
+			return nil, ErrTaskTimeout
 		default:
 			logrus.WithField("status", resp.Status).Debug("Polling task")
 		}
@@ -357,6 +395,36 @@ func (c *client) PollTaskStatus(refURL string, timeout time.Duration) (*Executio
 }
 
 func (c *client) GetPipelineConfig(app, pipelineConfigID string) (*PipelineConfig, error) {
+	respBody, err := c.getPipelineConfig(app, pipelineConfigID)
+	if err != nil || respBody == nil {
+		return nil, err
+	}
+
+	var config PipelineConfig
+	if err := json.Unmarshal(respBody, &config); err != nil {
+		return nil, errors.Wrap(err, "failed unmarshaling pipeline config response")
+	}
+
+	return &config, nil
+}
+
+func (c *client) GetPipelineConfigMap(app, pipelineConfigID string) (map[string]interface{}, error) {
+	respBody, err := c.getPipelineConfig(app, pipelineConfigID)
+	if err != nil || respBody == nil {
+		return nil, err
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal(respBody, &config); err != nil {
+		return nil, errors.Wrap(err, "failed unmarshaling pipeline config response")
+	}
+
+	return config, nil
+}
+
+// getPipelineConfig returns the body of a pipeline config, or nil if the
+// pipeline does not exist.
+func (c *client) getPipelineConfig(app, pipelineConfigID string) ([]byte, error) {
 	url := c.pipelineConfigURL(app, pipelineConfigID)
 	logrus.WithField("url", url).Debug("getting url")
 	resp, err := c.httpClient.Get(url)
@@ -385,7 +453,7 @@ func (c *client) GetPipelineConfig(app, pipelineConfigID string) (*PipelineConfi
 		if resp.StatusCode == http.StatusNotFound {
 			return nil, nil
 		}
-		return nil, errors.New("get pipeline config failed")
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "get pipeline config failed")
 	}
 
 	// TODO rz - HACK: Spinnaker bug returning 200 on a pipeline config that isn't found
@@ -393,12 +461,7 @@ func (c *client) GetPipelineConfig(app, pipelineConfigID string) (*PipelineConfi
 		return nil, nil
 	}
 
-	var config PipelineConfig
-	if err := json.Unmarshal(respBody, &config); err != nil {
-		return nil, errors.Wrap(err, "failed unmarshaling pipeline config response")
-	}
-
-	return &config, nil
+	return respBody, nil
 }
 
 func (c *client) ListPipelineConfigs(app string) ([]PipelineConfig, error) {
@@ -415,7 +478,7 @@ func (c *client) ListPipelineConfigs(app string) ([]PipelineConfig, error) {
 	}).Debug("Response")
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("Unable to fetch pipeline list: " + strconv.Itoa(resp.StatusCode))
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "Unable to fetch pipeline list")
 	}
 
 	var pipelineInfo []PipelineConfig
@@ -426,12 +489,21 @@ func (c *client) ListPipelineConfigs(app string) ([]PipelineConfig, error) {
 	return pipelineInfo, nil
 }
 
-func (c *client) ExecPipeline(appName string, pipelineName string) (*TaskRefResponse, error) {
-	_, respBody, err := c.postJSON(fmt.Sprintf("%s/pipelines/%s/%s", c.endpoint, appName, pipelineName), nil)
+func (c *client) ExecPipeline(appName string, pipelineName string, trigger ExecutionTrigger) (*TaskRefResponse, error) {
+	resp, respBody, err := c.postJSON(c.pipelineURL(appName, pipelineName), trigger)
 	if err != nil {
 		return nil, errors.Wrap(err, "executing pipeline")
 	}
 
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: c.pipelineURL(appName, pipelineName)}, "execute pipeline request failed")
+	}
+
 	var taskResponse TaskRefResponse
 	err = json.Unmarshal(respBody, &taskResponse)
 	return &taskResponse, errors.Wrapf(err, "failed unmarshalling task response: %s", respBody)
@@ -452,7 +524,7 @@ func (c *client) SavePipelineConfig(pipelineConfig PipelineConfig) error {
 	}).Debug("Response")
 
 	if resp.StatusCode != http.StatusOK {
-		return errors.New("plan request failed")
+		return errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "save pipeline request failed")
 	}
 
 	return nil
@@ -474,7 +546,7 @@ func (c *client) DeletePipeline(app string, pipelineID string) error {
 	}).Debug("Response")
 
 	if resp.StatusCode != http.StatusOK {
-		return errors.New("delete request failed")
+		return errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "delete request failed")
 	}
 
 	return nil
@@ -492,3 +564,339 @@ func (c *client) FiatLogin(fiatUser string, fiatPass string) error {
 
 	return nil
 }
+
+// ListExecutionsOptions filters the executions returned by
+// ListPipelineExecutions.
+type ListExecutionsOptions struct {
+	PipelineName string
+	Statuses     []string
+	Limit        int
+}
+
+func (c *client) ListPipelineExecutions(app string, options ListExecutionsOptions) ([]PipelineExecution, error) {
+	params := url.Values{}
+	if options.Limit > 0 {
+		// Orca applies the limit per pipeline config, so it is reapplied below
+		// once the executions have been filtered and sorted.
+		params.Set("limit", strconv.Itoa(options.Limit))
+	}
+	if len(options.Statuses) > 0 {
+		params.Set("statuses", strings.ToUpper(strings.Join(options.Statuses, ",")))
+	}
+
+	url := c.applicationPipelinesURL(app)
+	if len(params) > 0 {
+		url = url + "?" + params.Encode()
+	}
+	resp, respBody, err := c.getJSON(url)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get pipeline executions")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "Unable to fetch pipeline executions")
+	}
+
+	var executions []PipelineExecution
+	if err := json.Unmarshal(respBody, &executions); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling pipeline executions")
+	}
+
+	filtered := []PipelineExecution{}
+	for _, e := range executions {
+		if options.PipelineName == "" || e.Name == options.PipelineName {
+			filtered = append(filtered, e)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].BuildTime > filtered[j].BuildTime
+	})
+	if options.Limit > 0 && len(filtered) > options.Limit {
+		filtered = filtered[:options.Limit]
+	}
+
+	return filtered, nil
+}
+
+func (c *client) GetPipelineExecution(executionID string) (*PipelineExecution, error) {
+	url := c.pipelineExecutionURL(executionID)
+	resp, respBody, err := c.getJSON(url)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get pipeline execution")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "Unable to fetch pipeline execution "+executionID)
+	}
+
+	var execution PipelineExecution
+	if err := json.Unmarshal(respBody, &execution); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling pipeline execution")
+	}
+
+	return &execution, nil
+}
+
+func (c *client) CancelPipelineExecution(executionID string, reason string) error {
+	cancelURL := c.pipelineExecutionURL(executionID) + "/cancel"
+	if reason != "" {
+		cancelURL = cancelURL + "?" + url.Values{"reason": {reason}}.Encode()
+	}
+	return c.updateExecution(cancelURL, "cancel")
+}
+
+func (c *client) PausePipelineExecution(executionID string) error {
+	return c.updateExecution(c.pipelineExecutionURL(executionID)+"/pause", "pause")
+}
+
+func (c *client) ResumePipelineExecution(executionID string) error {
+	return c.updateExecution(c.pipelineExecutionURL(executionID)+"/resume", "resume")
+}
+
+func (c *client) updateExecution(url string, action string) error {
+	logrus.WithField("url", url).Debugf("requesting execution %s", action)
+	resp, respBody, err := c.put(url, nil)
+
+	if err != nil {
+		return errors.Wrapf(err, "%s pipeline execution", action)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, action+" request failed")
+	}
+
+	return nil
+}
+
+func (c *client) JudgeStage(executionID string, stageID string, judgment ManualJudgment) error {
+	url := c.pipelineExecutionURL(executionID) + "/stages/" + stageID
+	logrus.WithField("url", url).Debug("judging stage")
+	resp, respBody, err := c.patchJSON(url, judgment)
+
+	if err != nil {
+		return errors.Wrap(err, "judge stage")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "judge stage request failed")
+	}
+
+	return nil
+}
+
+func (c *client) RestartStage(executionID string, stageID string) error {
+	url := c.pipelineExecutionURL(executionID) + "/stages/" + stageID + "/restart"
+	logrus.WithField("url", url).Debug("restarting stage")
+	resp, respBody, err := c.put(url, map[string]interface{}{})
+
+	if err != nil {
+		return errors.Wrap(err, "restart stage")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "restart stage request failed")
+	}
+
+	return nil
+}
+
+func (c *client) ListTemplates(scopes []string) ([]map[string]interface{}, error) {
+	params := url.Values{}
+	if len(scopes) > 0 {
+		params.Set("scopes", strings.Join(scopes, ","))
+	}
+
+	url := c.pipelineTemplatesURL()
+	if len(params) > 0 {
+		url = url + "?" + params.Encode()
+	}
+	resp, respBody, err := c.getJSON(url)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get pipeline template list")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "Unable to fetch pipeline template list")
+	}
+
+	var templates []map[string]interface{}
+	if err := json.Unmarshal(respBody, &templates); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling pipeline template list")
+	}
+
+	return templates, nil
+}
+
+func (c *client) GetTemplate(templateID string) (map[string]interface{}, error) {
+	url := c.pipelineTemplatesURL() + "/" + templateID
+	resp, respBody, err := c.getJSON(url)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get pipeline template")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "Unable to determine state of the pipeline template "+templateID)
+	}
+
+	var template map[string]interface{}
+	if err := json.Unmarshal(respBody, &template); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling pipeline template")
+	}
+
+	return template, nil
+}
+
+func (c *client) ListTemplateDependents(templateID string, recursive bool) ([]PipelineConfig, error) {
+	url := c.pipelineTemplatesURL() + "/" + templateID + "/dependents?recursive=" + strconv.FormatBool(recursive)
+	resp, respBody, err := c.getJSON(url)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get pipeline template dependents")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "Unable to fetch pipeline template dependents")
+	}
+
+	var dependents []PipelineConfig
+	if err := json.Unmarshal(respBody, &dependents); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling pipeline template dependents")
+	}
+
+	return dependents, nil
+}
+
+func (c *client) ListPipelineConfigMaps(app string) ([]map[string]interface{}, error) {
+	return c.listConfigMaps(c.pipelineConfigsURL(app), "pipeline")
+}
+
+func (c *client) SavePipelineConfigMap(pipelineConfig map[string]interface{}) error {
+	return c.saveConfigMap(c.pipelinesURL(), "pipeline", pipelineConfig)
+}
+
+func (c *client) ListStrategyConfigs(app string) ([]map[string]interface{}, error) {
+	return c.listConfigMaps(c.strategyConfigsURL(app), "strategy")
+}
+
+func (c *client) SaveStrategyConfig(strategyConfig map[string]interface{}) error {
+	return c.saveConfigMap(c.strategiesURL(), "strategy", strategyConfig)
+}
+
+func (c *client) listConfigMaps(url, kind string) ([]map[string]interface{}, error) {
+	resp, respBody, err := c.getJSON(url)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get %s list", kind)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "Unable to fetch %s list", kind)
+	}
+
+	var configs []map[string]interface{}
+	if err := json.Unmarshal(respBody, &configs); err != nil {
+		return nil, errors.Wrapf(err, "unmarshaling %s list", kind)
+	}
+
+	return configs, nil
+}
+
+func (c *client) saveConfigMap(url, kind string, config map[string]interface{}) error {
+	logrus.WithField("url", url).Debugf("saving %s", kind)
+	resp, respBody, err := c.postJSON(url, config)
+
+	if err != nil {
+		return errors.Wrapf(err, "save %s config", kind)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Wrapf(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "save %s request failed", kind)
+	}
+
+	return nil
+}
+
+func (c *client) ListAccounts() ([]Account, error) {
+	url := c.credentialsURL()
+	resp, respBody, err := c.getJSON(url)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get account list")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}).Debug("Response")
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrap(&ResponseError{StatusCode: resp.StatusCode, URL: url}, "Unable to fetch account list")
+	}
+
+	var accounts []Account
+	if err := json.Unmarshal(respBody, &accounts); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling account list")
+	}
+
+	return accounts, nil
+}
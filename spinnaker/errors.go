@@ -0,0 +1,32 @@
+package spinnaker
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ResponseError is returned when the Spinnaker API responds with an
+// unexpected status code.
+type ResponseError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("unexpected response from %s, status: %d", e.URL, e.StatusCode)
+}
+
+// IsTransient returns true if the error is likely to go away on retry: network
+// errors, timeouts and 5xx or 429 responses from the API.
+func IsTransient(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case *ResponseError:
+		return cause.StatusCode >= http.StatusInternalServerError || cause.StatusCode == http.StatusTooManyRequests
+	case net.Error:
+		return true
+	}
+	return false
+}
@@ -26,55 +26,92 @@ func DefaultHTTPClientFactory(cc *cli.Context) (*http.Client, error) {
 	if cc == nil {
 		logrus.Panic("cli context has not been set")
 	}
+
+	opts := httpClientOptions{
+		endpoint: os.Getenv("SPINNAKER_API"),
+		timeout:  time.Duration(cc.GlobalInt("clientTimeout")) * time.Second,
+		insecure: cc.GlobalIsSet("insecure"),
+	}
+	if cc.GlobalIsSet("apiSession") {
+		opts.session = cc.GlobalString("apiSession")
+	}
+
+	if cc.GlobalIsSet("certPath") {
+		opts.certPath = cc.GlobalString("certPath")
+	} else if os.Getenv("SPINNAKER_CLIENT_CERT") != "" {
+		opts.certPath = os.Getenv("SPINNAKER_CLIENT_CERT")
+	}
+	if cc.GlobalIsSet("keyPath") {
+		opts.keyPath = cc.GlobalString("keyPath")
+	} else if os.Getenv("SPINNAKER_CLIENT_KEY") != "" {
+		opts.keyPath = os.Getenv("SPINNAKER_CLIENT_KEY")
+	}
+
+	return newHTTPClient(opts)
+}
+
+// TargetHTTPClientFactory creates the http.Client for the target Spinnaker
+// of a migration, configured by the --target-* flags of the command rather
+// than the global flags.
+func TargetHTTPClientFactory(cc *cli.Context) (*http.Client, error) {
+	if cc == nil {
+		logrus.Panic("cli context has not been set")
+	}
+
+	opts := httpClientOptions{
+		endpoint: cc.String("target-api"),
+		timeout:  time.Duration(cc.GlobalInt("clientTimeout")) * time.Second,
+		session:  cc.String("target-api-session"),
+		certPath: cc.String("target-cert-path"),
+		keyPath:  cc.String("target-key-path"),
+		insecure: cc.Bool("target-insecure"),
+	}
+	return newHTTPClient(opts)
+}
+
+// httpClientOptions configures the authentication of an http.Client for a
+// Gate endpoint.
+type httpClientOptions struct {
+	endpoint string
+	timeout  time.Duration
+	session  string
+	certPath string
+	keyPath  string
+	insecure bool
+}
+
+func newHTTPClient(opts httpClientOptions) (*http.Client, error) {
 	var c http.Client
 	cookieJar, _ := cookiejar.New(nil)
 
-	if cc.GlobalIsSet("apiSession") {
+	if opts.session != "" {
 		var cookies []*http.Cookie
 		cookie := &http.Cookie{
 			Name:  "SESSION",
-			Value: cc.GlobalString("apiSession"),
+			Value: opts.session,
 		}
 		cookies = append(cookies, cookie)
-		u, _ := url.Parse(os.Getenv("SPINNAKER_API"))
+		u, _ := url.Parse(opts.endpoint)
 		cookieJar.SetCookies(u, cookies)
 	}
 
 	c = http.Client{
-		Timeout: time.Duration(cc.GlobalInt("clientTimeout")) * time.Second,
+		Timeout: opts.timeout,
 		Jar:     cookieJar,
 	}
 
-	var certPath string
-	var keyPath string
-
-	if cc.GlobalIsSet("certPath") {
-		certPath = cc.GlobalString("certPath")
-	} else if os.Getenv("SPINNAKER_CLIENT_CERT") != "" {
-		certPath = os.Getenv("SPINNAKER_CLIENT_CERT")
-	} else {
-		certPath = ""
-	}
-	if cc.GlobalIsSet("keyPath") {
-		keyPath = cc.GlobalString("keyPath")
-	} else if os.Getenv("SPINNAKER_CLIENT_KEY") != "" {
-		keyPath = os.Getenv("SPINNAKER_CLIENT_KEY")
-	} else {
-		keyPath = ""
-	}
-
 	c.Transport = &http.Transport{
 		TLSClientConfig: &tls.Config{},
 	}
 
-	if certPath != "" && keyPath != "" {
+	if opts.certPath != "" && opts.keyPath != "" {
 		logrus.Debug("Configuring TLS with pem cert/key pair")
-		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		cert, err := tls.LoadX509KeyPair(opts.certPath, opts.keyPath)
 		if err != nil {
 			return nil, errors.Wrap(err, "loading x509 keypair")
 		}
 
-		clientCA, err := ioutil.ReadFile(certPath)
+		clientCA, err := ioutil.ReadFile(opts.certPath)
 		if err != nil {
 			return nil, errors.Wrap(err, "loading client CA")
 		}
@@ -88,7 +125,7 @@ func DefaultHTTPClientFactory(cc *cli.Context) (*http.Client, error) {
 		c.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify = true
 	}
 
-	if cc.GlobalIsSet("insecure") {
+	if opts.insecure {
 		c.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify = true
 	}
 
@@ -183,3 +220,45 @@ func (c *client) delete(url string) (resp *http.Response, respBody []byte, err e
 
 	return resp, respBody, nil
 }
+
+func (c *client) put(url string, body interface{}) (resp *http.Response, respBody []byte, err error) {
+	return c.sendJSON("PUT", url, body)
+}
+
+func (c *client) patchJSON(url string, body interface{}) (resp *http.Response, respBody []byte, err error) {
+	return c.sendJSON("PATCH", url, body)
+}
+
+func (c *client) sendJSON(method string, url string, body interface{}) (resp *http.Response, respBody []byte, err error) {
+	var payload []byte
+	if body != nil {
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "marshaling body to json")
+		}
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to create %s request object", method)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err = c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to make %s request to %s", method, url)
+	}
+
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil && err != nil {
+			err = errors.Wrapf(err, "failed to close response body from %s", url)
+		}
+	}()
+
+	respBody, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to read response body from url %s", url)
+	}
+
+	return resp, respBody, nil
+}
@@ -1,6 +1,8 @@
 package spinnaker
 
 import (
+	"time"
+
 	"github.com/mitchellh/mapstructure"
 	"github.com/sirupsen/logrus"
 )
@@ -19,18 +21,18 @@ type templatedPipelineRequest struct {
 type TemplatedPipelineErrorResponse struct {
 	Errors  []TemplatedPipelineError `json:"errors"`
 	Message string                   `json:"message"`
-	Status  string                   `json:"status"`
+	Status  string                   `json:"status,omitempty"`
 }
 
 // TemplatedPipelineError represents a single validation error
 type TemplatedPipelineError struct {
-	Location     string                   `json:"location"`
+	Location     string                   `json:"location,omitempty"`
 	Message      string                   `json:"message"`
-	Suggestion   string                   `json:"suggestion"`
-	Cause        string                   `json:"cause"`
+	Suggestion   string                   `json:"suggestion,omitempty"`
+	Cause        string                   `json:"cause,omitempty"`
 	Severity     string                   `json:"severity"`
-	Detail       map[string]string        `json:"detail"`
-	NestedErrors []TemplatedPipelineError `json:"nestedErrors"`
+	Detail       map[string]string        `json:"detail,omitempty"`
+	NestedErrors []TemplatedPipelineError `json:"nestedErrors,omitempty"`
 }
 
 // Task is a single task
@@ -110,12 +112,12 @@ type exceptionVariable struct {
 
 // RetrofitErrorResponse represents a Retrofit error.
 type RetrofitErrorResponse struct {
-	Error        string   `mapstructure:"error"`
-	Errors       []string `mapstructure:"errors"`
-	Kind         string   `mapstructure:"kind"`
-	ResponseBody string   `mapstructure:"responseBody"`
-	Status       int      `mapstructure:"status"`
-	URL          string   `mapstructure:"url"`
+	Error        string   `mapstructure:"error" json:"error,omitempty"`
+	Errors       []string `mapstructure:"errors" json:"errors,omitempty"`
+	Kind         string   `mapstructure:"kind" json:"kind,omitempty"`
+	ResponseBody string   `mapstructure:"responseBody" json:"responseBody,omitempty"`
+	Status       int      `mapstructure:"status" json:"status,omitempty"`
+	URL          string   `mapstructure:"url" json:"url,omitempty"`
 }
 
 // PipelineConfig represents full pipeline config
@@ -144,9 +146,114 @@ type ApplicationInfo struct {
 	Name string `json:"name"`
 }
 
+// Account is a cloud provider or docker registry account. The format of
+// Regions differs between cloud providers: a list of names, or of objects
+// with a name.
+type Account struct {
+	Name    string        `json:"name"`
+	Type    string        `json:"type"`
+	Regions []interface{} `json:"regions,omitempty"`
+}
+
 // PipelineLock pipeline lock
 type PipelineLock struct {
 	AllowUnlockUI bool   `json:"allowUnlockUi"`
 	Description   string `json:"description"`
 	UI            bool   `json:"ui"`
 }
+
+// PipelineExecution represents a single pipeline execution as returned by
+// Orca.
+type PipelineExecution struct {
+	ID                 string           `json:"id"`
+	Name               string           `json:"name"`
+	Application        string           `json:"application"`
+	PipelineConfigID   string           `json:"pipelineConfigId,omitempty"`
+	Status             string           `json:"status"`
+	BuildTime          int64            `json:"buildTime,omitempty"`
+	StartTime          int64            `json:"startTime,omitempty"`
+	EndTime            int64            `json:"endTime,omitempty"`
+	Canceled           bool             `json:"canceled,omitempty"`
+	CanceledBy         string           `json:"canceledBy,omitempty"`
+	CancellationReason string           `json:"cancellationReason,omitempty"`
+	Trigger            ExecutionTrigger `json:"trigger"`
+	Stages             []ExecutionStage `json:"stages"`
+}
+
+// Complete returns true when the execution has reached a terminal state.
+func (e PipelineExecution) Complete() bool {
+	switch e.Status {
+	case "SUCCEEDED", "FAILED_CONTINUE", "TERMINAL", "CANCELED", "STOPPED", "SKIPPED":
+		return true
+	}
+	return false
+}
+
+// Duration returns the time the execution has been running so far, or its
+// total runtime once it has completed.
+func (e PipelineExecution) Duration() time.Duration {
+	return elapsed(e.StartTime, e.EndTime)
+}
+
+// ExecutionTrigger describes what started a pipeline execution.
+type ExecutionTrigger struct {
+	Type       string                   `json:"type"`
+	User       string                   `json:"user,omitempty"`
+	Parameters map[string]interface{}   `json:"parameters,omitempty"`
+	Artifacts  []map[string]interface{} `json:"artifacts,omitempty"`
+}
+
+// ExecutionStage partially represents a single stage of a pipeline execution.
+type ExecutionStage struct {
+	ID                   string                 `json:"id"`
+	RefID                string                 `json:"refId"`
+	Type                 string                 `json:"type"`
+	Name                 string                 `json:"name"`
+	Status               string                 `json:"status"`
+	StartTime            int64                  `json:"startTime,omitempty"`
+	EndTime              int64                  `json:"endTime,omitempty"`
+	ParentStageID        string                 `json:"parentStageId,omitempty"`
+	SyntheticStageOwner  string                 `json:"syntheticStageOwner,omitempty"`
+	RequisiteStageRefIDs []string               `json:"requisiteStageRefIds,omitempty"`
+	Context              map[string]interface{} `json:"context,omitempty"`
+	Outputs              map[string]interface{} `json:"outputs,omitempty"`
+	Tasks                []ExecutionStep        `json:"tasks,omitempty"`
+}
+
+// Duration returns the time the stage has been running so far, or its total
+// runtime once it has completed.
+func (s ExecutionStage) Duration() time.Duration {
+	return elapsed(s.StartTime, s.EndTime)
+}
+
+// ExtractException decodes the exception Orca records in the stage context
+// when a stage fails. It returns nil if the stage has no exception.
+func (s ExecutionStage) ExtractException() *RetrofitErrorResponse {
+	exception, ok := s.Context["exception"]
+	if !ok {
+		return nil
+	}
+	var decoded exceptionVariable
+	if err := mapstructure.WeakDecode(exception, &decoded); err != nil {
+		logrus.WithError(err).WithField("stage", s.Name).Warn("could not decode stage exception")
+		return nil
+	}
+	return &decoded.Details
+}
+
+func elapsed(startTime, endTime int64) time.Duration {
+	if startTime == 0 {
+		return 0
+	}
+	if endTime == 0 {
+		return time.Since(time.Unix(0, startTime*int64(time.Millisecond)))
+	}
+	return time.Duration(endTime-startTime) * time.Millisecond
+}
+
+// ManualJudgment is the judgment submitted to a waiting manualJudgment stage.
+type ManualJudgment struct {
+	JudgmentStatus  string `json:"judgmentStatus"`
+	JudgmentInput   string `json:"judgmentInput,omitempty"`
+	JudgmentMessage string `json:"judgmentMessage,omitempty"`
+}
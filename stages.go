@@ -0,0 +1,76 @@
+package roer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// findStage looks up a top-level stage of an execution by its refId or, if no
+// refId matches, by its name.
+func findStage(execution spinnaker.PipelineExecution, selector string) (*spinnaker.ExecutionStage, error) {
+	stages := topLevelStages(execution)
+	for i := range stages {
+		if stages[i].RefID == selector {
+			return &stages[i], nil
+		}
+	}
+
+	var found *spinnaker.ExecutionStage
+	for i := range stages {
+		if stages[i].Name != selector {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("stage name %q is ambiguous, select the stage by refId instead", selector)
+		}
+		found = &stages[i]
+	}
+	if found == nil {
+		return nil, notFound("could not find stage %q in execution %s", selector, execution.ID)
+	}
+	return found, nil
+}
+
+// waitingJudgments returns the manualJudgment stages of an execution that are
+// waiting for someone to judge them.
+func waitingJudgments(execution spinnaker.PipelineExecution) []spinnaker.ExecutionStage {
+	waiting := []spinnaker.ExecutionStage{}
+	for _, s := range topLevelStages(execution) {
+		if s.Type != "manualJudgment" || s.Status != "RUNNING" {
+			continue
+		}
+		if status, ok := s.Context["judgmentStatus"]; ok && status != nil && status != "" {
+			continue
+		}
+		waiting = append(waiting, s)
+	}
+	return waiting
+}
+
+// validateJudgmentInput checks the input against the judgment inputs the stage
+// offers, if it offers any.
+func validateJudgmentInput(stage spinnaker.ExecutionStage, input string) error {
+	var options []struct {
+		Value string `mapstructure:"value"`
+	}
+	if err := mapstructure.WeakDecode(stage.Context["judgmentInputs"], &options); err != nil || len(options) == 0 {
+		return nil
+	}
+
+	allowed := []string{}
+	for _, o := range options {
+		if o.Value == input {
+			return nil
+		}
+		allowed = append(allowed, o.Value)
+	}
+	return fmt.Errorf("judgment input must be one of [%s], got %q", strings.Join(allowed, ", "), input)
+}
+
+// judgeCommand returns the roer command that continues a waiting judgment.
+func judgeCommand(executionID string, stage spinnaker.ExecutionStage) string {
+	return fmt.Sprintf("roer pipeline executions judge %s --stage %s --continue", executionID, stage.RefID)
+}
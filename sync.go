@@ -0,0 +1,284 @@
+package roer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// Actions of a pipeline sync plan.
+const (
+	syncCreate    = "create"
+	syncUpdate    = "update"
+	syncDelete    = "delete"
+	syncUnchanged = "unchanged"
+)
+
+// volatilePipelineFields are set by Spinnaker whenever a pipeline is saved,
+// so they are ignored when comparing pipelines and can be left out of
+// exports. Generated stage ids are ignored as well.
+var volatilePipelineFields = []string{"id", "updateTs", "lastModifiedBy"}
+
+// localPipeline is a pipeline read from a file. Pipelines are kept as
+// generic maps, so fields PipelineConfig does not model, such as disabled,
+// locked or roles, are synced too. Templated pipelines are built from a
+// pipeline template configuration, which only sets some of their fields.
+type localPipeline struct {
+	file      string
+	pipeline  map[string]interface{}
+	templated bool
+}
+
+// syncChange is a single step of a pipeline sync plan.
+type syncChange struct {
+	action   string
+	name     string
+	file     string
+	pipeline map[string]interface{}
+	changes  []valueChange
+}
+
+// readPipelineFile reads a pipeline from a file: a raw pipeline from a .json
+// file, and a pipeline template configuration or a raw pipeline, as exported
+// by roer, from a .yml or .yaml file. Pipeline template configurations are
+// returned as well. It returns false for files without a pipeline, such as
+// templates.
+func readPipelineFile(path string) (map[string]interface{}, map[string]interface{}, bool, error) {
+	switch filepath.Ext(path) {
+	case ".json":
+		dat, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, nil, false, errors.Wrapf(err, "reading %s", path)
+		}
+		var pipeline map[string]interface{}
+		if err := json.Unmarshal(dat, &pipeline); err != nil {
+			return nil, nil, false, errors.Wrapf(err, "unmarshaling pipeline in %s", path)
+		}
+		return pipeline, nil, true, nil
+	case ".yml", ".yaml":
+		m, err := readYamlFile(path)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if _, ok := m["pipeline"]; ok {
+			var config PipelineConfiguration
+			if err := mapstructure.Decode(m, &config); err != nil {
+				return nil, nil, false, errors.Wrapf(err, "decoding pipeline configuration in %s", path)
+			}
+			var pipeline map[string]interface{}
+			if err := convertMap(config.ToClient(), &pipeline); err != nil {
+				return nil, nil, false, errors.Wrapf(err, "converting pipeline configuration in %s", path)
+			}
+			// The configuration is saved as written, not as modeled.
+			pipeline["config"] = m
+			return pipeline, m, true, nil
+		}
+		if _, ok := m["name"]; ok {
+			return m, nil, true, nil
+		}
+	}
+	return nil, nil, false, nil
+}
+
+// pipelineField returns a string field of a pipeline, such as its name.
+func pipelineField(pipeline map[string]interface{}, key string) string {
+	s, _ := pipeline[key].(string)
+	return s
+}
+
+// readPipelineDir reads the pipelines in the files of a directory tree.
+// Pipelines without an application are assigned to app; pipelines of another
+// application are an error.
+func readPipelineDir(dir, app string) ([]localPipeline, error) {
+	pipelines := []localPipeline{}
+	names := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		pipeline, config, ok, err := readPipelineFile(path)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			logrus.WithField("file", path).Debug("Skipping file without a pipeline")
+			return nil
+		}
+
+		name := pipelineField(pipeline, "name")
+		if name == "" {
+			return fmt.Errorf("pipeline in %s has no name", path)
+		}
+		if pipelineField(pipeline, "application") == "" {
+			pipeline["application"] = app
+		}
+		if other := pipelineField(pipeline, "application"); other != app {
+			return fmt.Errorf("pipeline %s in %s belongs to application %s, not %s", name, path, other, app)
+		}
+		if existing, ok := names[name]; ok {
+			return fmt.Errorf("pipeline %s is defined in both %s and %s", name, existing, path)
+		}
+		names[name] = path
+		pipelines = append(pipelines, localPipeline{file: path, pipeline: pipeline, templated: config != nil})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pipelines, func(i, j int) bool {
+		return pipelineField(pipelines[i].pipeline, "name") < pipelineField(pipelines[j].pipeline, "name")
+	})
+	return pipelines, nil
+}
+
+// normalizePipeline returns a copy of a pipeline without the fields Spinnaker
+// sets on every save and the generated stage ids.
+func normalizePipeline(pipeline map[string]interface{}) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := convertMap(pipeline, &m); err != nil {
+		return nil, err
+	}
+	for _, f := range volatilePipelineFields {
+		delete(m, f)
+	}
+	if stages, ok := m["stages"].([]interface{}); ok {
+		for _, s := range stages {
+			if stage, ok := s.(map[string]interface{}); ok {
+				delete(stage, "id")
+			}
+		}
+	}
+	return m, nil
+}
+
+// planPipelineSync compares the local pipelines with the pipelines of the
+// application. Existing pipelines are matched by name, so they keep their
+// ids. Templated pipelines are only compared on the fields their
+// configuration sets, since Spinnaker fills in the others. With prune set,
+// pipelines that only exist in Spinnaker are deleted.
+func planPipelineSync(client spinnaker.Client, app string, local []localPipeline, prune bool) ([]syncChange, error) {
+	remote, err := client.ListPipelineConfigMaps(app)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing pipelines")
+	}
+	remoteByName := map[string]map[string]interface{}{}
+	for _, r := range remote {
+		remoteByName[pipelineField(r, "name")] = r
+	}
+
+	plan := []syncChange{}
+	synced := map[string]bool{}
+	for _, l := range local {
+		name := pipelineField(l.pipeline, "name")
+		synced[name] = true
+		change := syncChange{name: name, file: l.file, pipeline: l.pipeline}
+
+		existing, err := client.GetPipelineConfig(app, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetching pipeline %s", name)
+		}
+		if existing == nil {
+			change.action = syncCreate
+			delete(change.pipeline, "id")
+			plan = append(plan, change)
+			continue
+		}
+
+		change.pipeline["id"] = existing.ID
+		from, err := normalizePipeline(remoteByName[name])
+		if err != nil {
+			return nil, err
+		}
+		to, err := normalizePipeline(change.pipeline)
+		if err != nil {
+			return nil, err
+		}
+		if l.templated {
+			from = definedFields(from, to)
+		}
+		change.changes = diffValues("", from, to)
+		change.action = syncUnchanged
+		if len(change.changes) > 0 {
+			change.action = syncUpdate
+		}
+		plan = append(plan, change)
+	}
+
+	if !prune {
+		return plan, nil
+	}
+	sort.Slice(remote, func(i, j int) bool {
+		return pipelineField(remote[i], "name") < pipelineField(remote[j], "name")
+	})
+	for _, r := range remote {
+		if name := pipelineField(r, "name"); !synced[name] {
+			plan = append(plan, syncChange{action: syncDelete, name: name, pipeline: r})
+		}
+	}
+	return plan, nil
+}
+
+// definedFields returns the fields of a remote pipeline that the local
+// pipeline defines as well.
+func definedFields(remote, local map[string]interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	for k, v := range remote {
+		if _, ok := local[k]; ok {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// applyPipelineSync saves and deletes pipelines as planned, stopping at the
+// first failure.
+func applyPipelineSync(client spinnaker.Client, app string, plan []syncChange) error {
+	for _, c := range plan {
+		log := logrus.WithFields(logrus.Fields{
+			"pipeline": c.name,
+			"action":   c.action,
+		})
+		switch c.action {
+		case syncCreate, syncUpdate:
+			log.Info("Saving pipeline")
+			if err := client.SavePipelineConfigMap(c.pipeline); err != nil {
+				return errors.Wrapf(err, "saving pipeline %s", c.name)
+			}
+		case syncDelete:
+			log.Info("Deleting pipeline")
+			if err := client.DeletePipeline(app, c.name); err != nil {
+				return errors.Wrapf(err, "deleting pipeline %s", c.name)
+			}
+		}
+	}
+	return nil
+}
+
+func printSyncPlan(plan []syncChange) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tPIPELINE\tFILE")
+	counts := map[string]int{}
+	for _, c := range plan {
+		counts[c.action]++
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.action, c.name, c.file)
+	}
+	w.Flush()
+
+	for _, c := range plan {
+		if c.action == syncUpdate {
+			fmt.Printf("\n%s:\n%s", c.name, formatChanges(c.changes, "  "))
+		}
+	}
+	fmt.Printf("\n%d to create, %d to update, %d to delete, %d unchanged\n",
+		counts[syncCreate], counts[syncUpdate], counts[syncDelete], counts[syncUnchanged])
+}
@@ -0,0 +1,152 @@
+package roer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// fakePipelineStore is a spinnaker.Client holding the pipelines of an
+// application in memory. Saving a pipeline sets the fields Spinnaker sets, and
+// the ones Orca fills in for templated pipelines.
+type fakePipelineStore struct {
+	spinnaker.Client
+	pipelines map[string]map[string]interface{}
+	saves     int
+}
+
+func (f *fakePipelineStore) ListPipelineConfigMaps(app string) ([]map[string]interface{}, error) {
+	pipelines := []map[string]interface{}{}
+	for _, p := range f.pipelines {
+		var m map[string]interface{}
+		if err := convertMap(p, &m); err != nil {
+			return nil, err
+		}
+		pipelines = append(pipelines, m)
+	}
+	return pipelines, nil
+}
+
+func (f *fakePipelineStore) GetPipelineConfig(app, name string) (*spinnaker.PipelineConfig, error) {
+	p, ok := f.pipelines[name]
+	if !ok {
+		return nil, nil
+	}
+	return &spinnaker.PipelineConfig{ID: p["id"].(string), Name: name, Application: app}, nil
+}
+
+func (f *fakePipelineStore) SavePipelineConfigMap(pipeline map[string]interface{}) error {
+	var m map[string]interface{}
+	if err := convertMap(pipeline, &m); err != nil {
+		return err
+	}
+	name := pipelineField(m, "name")
+	if _, ok := m["id"]; !ok {
+		m["id"] = "generated-" + name
+	}
+	m["updateTs"] = "1500000000000"
+	m["lastModifiedBy"] = "anonymous"
+	if m["type"] == "templatedPipeline" {
+		for _, k := range []string{"stages", "triggers", "parameterConfig", "notifications", "expectedArtifacts"} {
+			if _, ok := m[k]; !ok {
+				m[k] = []interface{}{}
+			}
+		}
+		m["index"] = float64(len(f.pipelines))
+	}
+	f.pipelines[name] = m
+	f.saves++
+	return nil
+}
+
+func TestPipelineSyncIsIdempotent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roer-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"templated.yml": `
+schema: "1"
+pipeline:
+  application: app
+  name: templated
+  template:
+    source: spinnaker://wait
+  variables:
+    waitTime: 5
+configuration:
+  concurrentExecutions:
+    limitConcurrent: false
+`,
+		"raw.json": `{
+  "name": "raw",
+  "application": "app",
+  "limitConcurrent": true,
+  "stages": [{"refId": "1", "type": "wait", "waitTime": 5}]
+}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := &fakePipelineStore{pipelines: map[string]map[string]interface{}{}}
+	sync := func() []syncChange {
+		local, err := readPipelineDir(dir, "app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := planPipelineSync(store, "app", local, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := applyPipelineSync(store, "app", plan); err != nil {
+			t.Fatal(err)
+		}
+		return plan
+	}
+
+	for _, c := range sync() {
+		if c.action != syncCreate {
+			t.Errorf("expected the first sync to create %s, got %s", c.name, c.action)
+		}
+	}
+	saves := store.saves
+	for _, c := range sync() {
+		if c.action != syncUnchanged {
+			t.Errorf("expected the second sync to leave %s unchanged, got %s: %s", c.name, c.action, formatChanges(c.changes, ""))
+		}
+	}
+	if store.saves != saves {
+		t.Errorf("expected the second sync not to save pipelines, saved %d", store.saves-saves)
+	}
+
+	// Changes to the local files are still planned.
+	if err := ioutil.WriteFile(filepath.Join(dir, "templated.yml"), []byte(`
+schema: "1"
+pipeline:
+  application: app
+  name: templated
+  template:
+    source: spinnaker://wait
+  variables:
+    waitTime: 10
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range sync() {
+		expected := syncUnchanged
+		if c.name == "templated" {
+			expected = syncUpdate
+		}
+		if c.action != expected {
+			t.Errorf("expected %s to be planned as %s, got %s", c.name, expected, c.action)
+		}
+	}
+}
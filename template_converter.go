@@ -49,7 +49,7 @@ func convertPipelineToTemplate(pipelineConfig spinnaker.PipelineConfig) Pipeline
 			Notifications:     convertNotifications(pipelineConfig.Notifications),
 			ExpectedArtifacts: pipelineConfig.ExpectedArtifacts,
 		},
-		Variables: make([]interface{}, 0),
+		Variables: make([]PipelineTemplateVariable, 0),
 		Stages:    convertStages(pipelineConfig.Stages),
 	}
 	return t
@@ -0,0 +1,237 @@
+package roer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// templateDoc is a template to document, and the page it is written to.
+type templateDoc struct {
+	template PipelineTemplate
+	file     string
+}
+
+// pageName returns the file name of the page documenting a template.
+func pageName(template PipelineTemplate) string {
+	return template.ID + ".md"
+}
+
+// templateTitle returns the name a template is documented under.
+func templateTitle(template PipelineTemplate) string {
+	if template.Metadata.Name != "" {
+		return template.Metadata.Name
+	}
+	return template.ID
+}
+
+// renderTemplateDoc renders the Markdown page of a template. Parents that are
+// documented along with it are linked to.
+func renderTemplateDoc(template PipelineTemplate, pages map[string]string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n\n", templateTitle(template))
+	if template.Metadata.Description != "" {
+		fmt.Fprintf(&buf, "%s\n\n", strings.TrimSpace(template.Metadata.Description))
+	}
+
+	fmt.Fprintln(&buf, "| | |")
+	fmt.Fprintln(&buf, "|---|---|")
+	fmt.Fprintf(&buf, "| ID | `%s` |\n", template.ID)
+	if template.Metadata.Owner != "" {
+		fmt.Fprintf(&buf, "| Owner | %s |\n", markdownCell(template.Metadata.Owner))
+	}
+	if len(template.Metadata.Scopes) > 0 {
+		fmt.Fprintf(&buf, "| Scopes | %s |\n", markdownCell(strings.Join(template.Metadata.Scopes, ", ")))
+	}
+	if template.Source != "" {
+		parent := "`" + template.Source + "`"
+		if page, ok := pages[strings.TrimPrefix(template.Source, "spinnaker://")]; ok {
+			parent = fmt.Sprintf("[%s](%s)", template.Source, page)
+		}
+		fmt.Fprintf(&buf, "| Parent | %s |\n", parent)
+	}
+	if template.Protect {
+		fmt.Fprintln(&buf, "| Protected | stages cannot be changed by configurations |")
+	}
+
+	if len(template.Variables) > 0 {
+		fmt.Fprint(&buf, "\n## Variables\n\n")
+		writeVariableTable(&buf, template.Variables)
+	}
+
+	if len(template.Stages) > 0 {
+		fmt.Fprint(&buf, "\n## Stages\n\n")
+		writeStageTable(&buf, template.Stages)
+		fmt.Fprintln(&buf)
+		writeStageGraph(&buf, template.Stages)
+	}
+
+	if len(template.Modules) > 0 {
+		fmt.Fprint(&buf, "\n## Modules\n")
+		for _, m := range template.Modules {
+			fmt.Fprintf(&buf, "\n### `%s`\n\n", m.ID)
+			if m.Usage != "" {
+				fmt.Fprintf(&buf, "%s\n\n", strings.TrimSpace(m.Usage))
+			}
+			if len(m.Variables) > 0 {
+				writeVariableTable(&buf, m.Variables)
+			}
+		}
+	}
+
+	if len(template.Partials) > 0 {
+		fmt.Fprint(&buf, "\n## Partials\n")
+		for _, p := range template.Partials {
+			fmt.Fprintf(&buf, "\n### `%s`\n\n", p.ID)
+			if p.Usage != "" {
+				fmt.Fprintf(&buf, "%s\n\n", strings.TrimSpace(p.Usage))
+			}
+			if len(p.Variables) > 0 {
+				writeVariableTable(&buf, p.Variables)
+				fmt.Fprintln(&buf)
+			}
+			writeStageTable(&buf, p.Stages)
+		}
+	}
+	return buf.String()
+}
+
+// renderTemplateIndex renders the index page linking to every template page.
+func renderTemplateIndex(docs []templateDoc) string {
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, "# Pipeline templates\n\n")
+	fmt.Fprintln(&buf, "| Template | ID | Owner | Description |")
+	fmt.Fprintln(&buf, "|---|---|---|---|")
+	for _, d := range docs {
+		description := strings.SplitN(strings.TrimSpace(d.template.Metadata.Description), "\n", 2)[0]
+		fmt.Fprintf(&buf, "| [%s](%s) | `%s` | %s | %s |\n",
+			markdownCell(templateTitle(d.template)), d.file, d.template.ID,
+			markdownCell(d.template.Metadata.Owner), markdownCell(description))
+	}
+	return buf.String()
+}
+
+func writeVariableTable(buf *bytes.Buffer, variables []PipelineTemplateVariable) {
+	fmt.Fprintln(buf, "| Name | Type | Default | Description |")
+	fmt.Fprintln(buf, "|---|---|---|---|")
+	for _, v := range variables {
+		def := "**required**"
+		if v.DefaultValue != nil {
+			def = markdownCode(v.DefaultValue)
+		} else if v.Nullable {
+			def = "`null`"
+		}
+		description := v.Description
+		if v.Example != nil {
+			description = strings.TrimSpace(description + " Example: " + markdownCode(v.Example))
+		}
+		fmt.Fprintf(buf, "| `%s` | %s | %s | %s |\n", v.Name, variableType(v), def, markdownCell(description))
+	}
+}
+
+func writeStageTable(buf *bytes.Buffer, stages []PipelineTemplateStage) {
+	fmt.Fprintln(buf, "| ID | Type | Name | Depends on | Condition |")
+	fmt.Fprintln(buf, "|---|---|---|---|---|")
+	for _, s := range stages {
+		deps := []string{}
+		for _, d := range s.DependsOn {
+			deps = append(deps, "`"+d+"`")
+		}
+		deps = append(deps, injectionRules(s.Inject)...)
+		conditions := []string{}
+		for _, w := range s.When {
+			conditions = append(conditions, markdownCode(w))
+		}
+		fmt.Fprintf(buf, "| `%s` | %s | %s | %s | %s |\n", s.ID, s.Type, markdownCell(s.Name),
+			strings.Join(deps, ", "), strings.Join(conditions, " and "))
+	}
+}
+
+func injectionRules(inject PipelineTemplateStageInjection) []string {
+	rules := []string{}
+	if inject.First {
+		rules = append(rules, "injected first")
+	}
+	if inject.Last {
+		rules = append(rules, "injected last")
+	}
+	for _, id := range inject.Before {
+		rules = append(rules, "injected before `"+id+"`")
+	}
+	for _, id := range inject.After {
+		rules = append(rules, "injected after `"+id+"`")
+	}
+	return rules
+}
+
+// writeStageGraph writes the stage dependency graph as a Mermaid flowchart.
+// Dependencies from injection rules are drawn dotted.
+func writeStageGraph(buf *bytes.Buffer, stages []PipelineTemplateStage) {
+	nodes := map[string]string{}
+	for i, s := range stages {
+		nodes[s.ID] = fmt.Sprintf("s%d", i)
+	}
+	next := len(stages)
+	node := func(id string) string {
+		if n, ok := nodes[id]; ok {
+			return n
+		}
+		n := fmt.Sprintf("s%d", next)
+		next++
+		nodes[id] = n
+		fmt.Fprintf(buf, "  %s[\"%s (missing)\"]\n", n, mermaidLabel(id))
+		return n
+	}
+
+	fmt.Fprintln(buf, "```mermaid")
+	fmt.Fprintln(buf, "graph TD")
+	for _, s := range stages {
+		label := s.ID
+		if s.Type != "" {
+			label += ": " + s.Type
+		}
+		fmt.Fprintf(buf, "  %s[\"%s\"]\n", nodes[s.ID], mermaidLabel(label))
+	}
+	for _, s := range stages {
+		for _, d := range s.DependsOn {
+			fmt.Fprintf(buf, "  %s --> %s\n", node(d), nodes[s.ID])
+		}
+		for _, id := range s.Inject.After {
+			fmt.Fprintf(buf, "  %s -.-> %s\n", node(id), nodes[s.ID])
+		}
+		for _, id := range s.Inject.Before {
+			fmt.Fprintf(buf, "  %s -.-> %s\n", nodes[s.ID], node(id))
+		}
+	}
+	fmt.Fprintln(buf, "```")
+}
+
+// sortTemplateDocs orders templates by id for the index.
+func sortTemplateDocs(docs []templateDoc) {
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].template.ID < docs[j].template.ID
+	})
+}
+
+func markdownCell(s string) string {
+	s = strings.Replace(s, "|", "\\|", -1)
+	return strings.Replace(strings.TrimSpace(s), "\n", " ", -1)
+}
+
+func markdownCode(v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		dat, err := json.Marshal(v)
+		if err != nil {
+			return markdownCell(fmt.Sprint(v))
+		}
+		s = string(dat)
+	}
+	return "`" + markdownCell(s) + "`"
+}
+
+func mermaidLabel(s string) string {
+	return strings.Replace(s, "\"", "#quot;", -1)
+}
@@ -0,0 +1,1564 @@
+package roer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// This file implements the subset of Jinja that MPT v1 templates use, so
+// templates can be rendered without Orca: {{ expressions }} with filters and
+// tests, {% if %} and {% for %} blocks, and the {% module %} tag. Like Orca,
+// rendering fails on undefined variables unless they are guarded with the
+// default filter or the defined test.
+
+// maxRenderDepth bounds nested module and partial rendering, which would
+// otherwise recurse forever on a module that includes itself.
+const maxRenderDepth = 16
+
+// renderContext holds the variables and modules available while rendering.
+type renderContext struct {
+	vars    map[string]interface{}
+	modules map[string]PipelineTemplateModule
+	depth   int
+}
+
+// with returns a child context with additional variables.
+func (c *renderContext) with(vars map[string]interface{}) *renderContext {
+	child := &renderContext{vars: map[string]interface{}{}, modules: c.modules, depth: c.depth}
+	for k, v := range c.vars {
+		child.vars[k] = v
+	}
+	for k, v := range vars {
+		child.vars[k] = v
+	}
+	return child
+}
+
+// undefined is the value of a variable or attribute that does not exist.
+type undefined struct {
+	name string
+}
+
+func (u undefined) err() error {
+	return fmt.Errorf("undefined variable %s", u.name)
+}
+
+// renderTree renders every string in a value decoded from YAML or JSON.
+func renderTree(v interface{}, ctx *renderContext) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return renderString(t, ctx)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			r, err := renderTree(item, ctx)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			r, err := renderTree(item, ctx)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// renderString renders a template string. A string consisting of a single
+// expression or module tag keeps the type of its value, so "{{ waitTime }}"
+// renders to a number. Rendered text that is a YAML list or object is decoded,
+// as Orca does.
+func renderString(s string, ctx *renderContext) (interface{}, error) {
+	if !strings.Contains(s, "{{") && !strings.Contains(s, "{%") && !strings.Contains(s, "{#") {
+		return s, nil
+	}
+	nodes, err := parseJinja(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %v", s, err)
+	}
+
+	if len(nodes) == 1 {
+		switch n := nodes[0].(type) {
+		case exprNode:
+			v, err := n.expr.eval(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if u, ok := v.(undefined); ok {
+				return nil, u.err()
+			}
+			return v, nil
+		case moduleNode:
+			return n.render(ctx)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := renderNodes(&buf, nodes, ctx); err != nil {
+		return nil, err
+	}
+	out := buf.String()
+	if trimmed := strings.TrimSpace(out); strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		var decoded interface{}
+		if err := yaml.Unmarshal([]byte(trimmed), &decoded); err == nil {
+			return decoded, nil
+		}
+	}
+	return out, nil
+}
+
+// isTruthy evaluates a rendered value as a condition.
+func isTruthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil, undefined:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != "" && !strings.EqualFold(strings.TrimSpace(t), "false")
+	case []interface{}:
+		return len(t) > 0
+	case map[string]interface{}:
+		return len(t) > 0
+	}
+	return true
+}
+
+// stringify formats a value the way Jinjava prints it into text.
+func stringify(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case undefined:
+		return "", t.err()
+	case string:
+		return t, nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(t), nil
+	}
+	dat, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(dat), nil
+}
+
+//
+// Template nodes
+//
+
+type jinjaNode interface{}
+
+type textNode string
+
+type exprNode struct {
+	expr jinjaExpr
+}
+
+type ifNode struct {
+	conds  []jinjaExpr
+	bodies [][]jinjaNode
+	orElse []jinjaNode
+}
+
+type forNode struct {
+	keyVar, valueVar string
+	iter             jinjaExpr
+	body             []jinjaNode
+}
+
+type moduleNode struct {
+	id   string
+	args map[string]jinjaExpr
+}
+
+func renderNodes(buf *bytes.Buffer, nodes []jinjaNode, ctx *renderContext) error {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case textNode:
+			buf.WriteString(string(n))
+		case exprNode:
+			v, err := n.expr.eval(ctx)
+			if err != nil {
+				return err
+			}
+			s, err := stringify(v)
+			if err != nil {
+				return err
+			}
+			buf.WriteString(s)
+		case moduleNode:
+			v, err := n.render(ctx)
+			if err != nil {
+				return err
+			}
+			s, err := stringify(v)
+			if err != nil {
+				return err
+			}
+			buf.WriteString(s)
+		case ifNode:
+			body := n.orElse
+			for i, cond := range n.conds {
+				v, err := cond.eval(ctx)
+				if err != nil {
+					return err
+				}
+				if isTruthy(v) {
+					body = n.bodies[i]
+					break
+				}
+			}
+			if err := renderNodes(buf, body, ctx); err != nil {
+				return err
+			}
+		case forNode:
+			if err := n.render(buf, ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (n forNode) render(buf *bytes.Buffer, ctx *renderContext) error {
+	v, err := n.iter.eval(ctx)
+	if err != nil {
+		return err
+	}
+
+	type pair struct{ key, value interface{} }
+	items := []pair{}
+	switch t := v.(type) {
+	case undefined:
+		return t.err()
+	case nil:
+	case []interface{}:
+		for i, item := range t {
+			items = append(items, pair{float64(i), item})
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			items = append(items, pair{k, t[k]})
+		}
+	default:
+		return fmt.Errorf("cannot loop over %T", v)
+	}
+
+	for i, item := range items {
+		vars := map[string]interface{}{
+			"loop": map[string]interface{}{
+				"index":  float64(i + 1),
+				"index0": float64(i),
+				"first":  i == 0,
+				"last":   i == len(items)-1,
+				"length": float64(len(items)),
+			},
+		}
+		switch _, isMap := v.(map[string]interface{}); {
+		case n.keyVar != "":
+			vars[n.keyVar] = item.key
+			vars[n.valueVar] = item.value
+		case isMap:
+			// Like Jinja, looping over a mapping with one variable yields keys.
+			vars[n.valueVar] = item.key
+		default:
+			vars[n.valueVar] = item.value
+		}
+		if err := renderNodes(buf, n.body, ctx.with(vars)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// render renders the module definition with the module variables, taken from
+// the tag arguments or the module defaults.
+func (n moduleNode) render(ctx *renderContext) (interface{}, error) {
+	module, ok := ctx.modules[n.id]
+	if !ok {
+		return nil, fmt.Errorf("module %s is not defined", n.id)
+	}
+	if ctx.depth >= maxRenderDepth {
+		return nil, fmt.Errorf("module %s is nested too deeply", n.id)
+	}
+
+	args := map[string]interface{}{}
+	for name, expr := range n.args {
+		v, err := expr.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if u, ok := v.(undefined); ok {
+			return nil, u.err()
+		}
+		args[name] = v
+	}
+	vars, err := resolveVariables(module.Variables, args)
+	if err != nil {
+		return nil, fmt.Errorf("module %s: %v", n.id, err)
+	}
+
+	moduleCtx := ctx.with(vars)
+	moduleCtx.depth++
+	v, err := renderTree(module.Definition, moduleCtx)
+	if err != nil {
+		return nil, fmt.Errorf("module %s: %v", n.id, err)
+	}
+	return v, nil
+}
+
+// resolveVariables returns the values of the declared variables, taking them
+// from values or falling back to their defaults. Nullable variables without a
+// default are nil. Undeclared values are passed through.
+func resolveVariables(declared []PipelineTemplateVariable, values map[string]interface{}) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	missing := []string{}
+	for _, d := range declared {
+		if d.Name == "" {
+			return nil, fmt.Errorf("variable without a name")
+		}
+		if v, ok := values[d.Name]; ok {
+			vars[d.Name] = v
+		} else if d.DefaultValue != nil || d.Nullable {
+			vars[d.Name] = d.DefaultValue
+		} else {
+			missing = append(missing, d.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing values for variables: %s", strings.Join(missing, ", "))
+	}
+	for k, v := range values {
+		if _, ok := vars[k]; !ok {
+			vars[k] = v
+		}
+	}
+	return vars, nil
+}
+
+//
+// Template parser
+//
+
+type jinjaSegment struct {
+	kind byte // 't' for text, 'e' for {{ }}, 's' for {% %}
+	text string
+}
+
+// splitJinja splits a template into text, expressions and statements,
+// dropping comments and applying {%- -%} whitespace control.
+func splitJinja(src string) ([]jinjaSegment, error) {
+	segments := []jinjaSegment{}
+	trimNext := false
+	for len(src) > 0 {
+		start := -1
+		for _, open := range []string{"{{", "{%", "{#"} {
+			if i := strings.Index(src, open); i >= 0 && (start < 0 || i < start) {
+				start = i
+			}
+		}
+		if start < 0 {
+			start = len(src)
+		}
+
+		text := src[:start]
+		if trimNext {
+			text = strings.TrimLeft(text, " \t\r\n")
+		}
+		if start == len(src) {
+			if text != "" {
+				segments = append(segments, jinjaSegment{'t', text})
+			}
+			break
+		}
+
+		closer := map[byte]string{'{': "}}", '%': "%}", '#': "#}"}[src[start+1]]
+		end := strings.Index(src[start+2:], closer)
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed %s", src[start:start+2])
+		}
+		inner := src[start+2 : start+2+end]
+		src = src[start+2+end+2:]
+
+		if strings.HasPrefix(inner, "-") {
+			text = strings.TrimRight(text, " \t\r\n")
+			inner = inner[1:]
+		}
+		trimNext = strings.HasSuffix(inner, "-")
+		if trimNext {
+			inner = inner[:len(inner)-1]
+		}
+		if text != "" {
+			segments = append(segments, jinjaSegment{'t', text})
+		}
+
+		switch closer {
+		case "}}":
+			segments = append(segments, jinjaSegment{'e', strings.TrimSpace(inner)})
+		case "%}":
+			segments = append(segments, jinjaSegment{'s', strings.TrimSpace(inner)})
+		}
+	}
+	return segments, nil
+}
+
+func parseJinja(src string) ([]jinjaNode, error) {
+	segments, err := splitJinja(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &jinjaParser{segments: segments}
+	nodes, end, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if end != "" {
+		return nil, fmt.Errorf("unexpected {%% %s %%}", end)
+	}
+	return nodes, nil
+}
+
+type jinjaParser struct {
+	segments []jinjaSegment
+	pos      int
+}
+
+// parseBlock parses nodes up to the end of the template or a block tag such
+// as else or endif, whose statement it returns.
+func (p *jinjaParser) parseBlock() ([]jinjaNode, string, error) {
+	nodes := []jinjaNode{}
+	for p.pos < len(p.segments) {
+		seg := p.segments[p.pos]
+		p.pos++
+		switch seg.kind {
+		case 't':
+			nodes = append(nodes, textNode(seg.text))
+		case 'e':
+			expr, err := parseExpression(seg.text)
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, exprNode{expr})
+		case 's':
+			keyword := strings.Fields(seg.text + " ")[0]
+			switch keyword {
+			case "elif", "else", "endif", "endfor":
+				return nodes, seg.text, nil
+			case "if":
+				n, err := p.parseIf(strings.TrimSpace(seg.text[2:]))
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, n)
+			case "for":
+				n, err := p.parseFor(strings.TrimSpace(seg.text[3:]))
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, n)
+			case "module":
+				n, err := parseModuleTag(strings.TrimSpace(seg.text[6:]))
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, n)
+			default:
+				return nil, "", fmt.Errorf("unsupported tag {%% %s %%}", keyword)
+			}
+		}
+	}
+	return nodes, "", nil
+}
+
+func (p *jinjaParser) parseIf(cond string) (jinjaNode, error) {
+	n := ifNode{}
+	for {
+		expr, err := parseExpression(cond)
+		if err != nil {
+			return nil, err
+		}
+		body, end, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		n.conds = append(n.conds, expr)
+		n.bodies = append(n.bodies, body)
+
+		switch {
+		case end == "endif":
+			return n, nil
+		case strings.HasPrefix(end, "elif "):
+			cond = strings.TrimSpace(end[5:])
+		case end == "else":
+			orElse, end, err := p.parseBlock()
+			if err != nil {
+				return nil, err
+			}
+			if end != "endif" {
+				return nil, fmt.Errorf("expected {%% endif %%}")
+			}
+			n.orElse = orElse
+			return n, nil
+		default:
+			return nil, fmt.Errorf("expected {%% endif %%}")
+		}
+	}
+}
+
+func (p *jinjaParser) parseFor(header string) (jinjaNode, error) {
+	parts := strings.SplitN(header, " in ", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid for loop %q", header)
+	}
+	n := forNode{}
+	names := strings.Split(parts[0], ",")
+	switch len(names) {
+	case 1:
+		n.valueVar = strings.TrimSpace(names[0])
+	case 2:
+		n.keyVar, n.valueVar = strings.TrimSpace(names[0]), strings.TrimSpace(names[1])
+	default:
+		return nil, fmt.Errorf("invalid for loop %q", header)
+	}
+
+	iter, err := parseExpression(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	n.iter = iter
+
+	body, end, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if end != "endfor" {
+		return nil, fmt.Errorf("expected {%% endfor %%}")
+	}
+	n.body = body
+	return n, nil
+}
+
+// parseModuleTag parses the arguments of {% module id name=value ... %}.
+func parseModuleTag(src string) (jinjaNode, error) {
+	tokens, err := lexExpression(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+
+	id := p.next()
+	if id.kind != tokName {
+		return nil, fmt.Errorf("module tag requires a module id")
+	}
+	n := moduleNode{id: id.text, args: map[string]jinjaExpr{}}
+	for p.peek().kind != tokEOF {
+		if p.peek().kind == tokOp && p.peek().text == "," {
+			p.next()
+			continue
+		}
+		name := p.next()
+		if name.kind != tokName || p.next().text != "=" {
+			return nil, fmt.Errorf("invalid argument to module %s", n.id)
+		}
+		value, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		n.args[name.text] = value
+	}
+	return n, nil
+}
+
+//
+// Expressions
+//
+
+const (
+	tokEOF = iota
+	tokName
+	tokNumber
+	tokString
+	tokOp
+)
+
+type exprToken struct {
+	kind  int
+	text  string
+	value interface{}
+}
+
+func lexExpression(src string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '_' || isLetter(c):
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || isLetter(src[j]) || isDigit(src[j])) {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: tokName, text: src[i:j]})
+			i = j
+		case isDigit(c):
+			j := i + 1
+			for j < len(src) && (isDigit(src[j]) || src[j] == '.' && j+1 < len(src) && isDigit(src[j+1])) {
+				j++
+			}
+			f, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: src[i:j], value: f})
+			i = j
+		case c == '"' || c == '\'':
+			var buf bytes.Buffer
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+					switch src[j] {
+					case 'n':
+						buf.WriteByte('\n')
+					case 't':
+						buf.WriteByte('\t')
+					default:
+						buf.WriteByte(src[j])
+					}
+					continue
+				}
+				buf.WriteByte(src[j])
+			}
+			if j == len(src) {
+				return nil, fmt.Errorf("unterminated string in %q", src)
+			}
+			tokens = append(tokens, exprToken{kind: tokString, text: src[i : j+1], value: buf.String()})
+			i = j + 1
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "//", "<", ">", "+", "-", "*", "/", "%", "~", "(", ")", "[", "]", "{", "}", ",", ".", "|", ":", "="} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q in %q", c, src)
+			}
+			tokens = append(tokens, exprToken{kind: tokOp, text: op})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{kind: tokEOF}), nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func parseExpression(src string) (jinjaExpr, error) {
+	tokens, err := lexExpression(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	expr, err := p.parseConditional()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q in %q", t.text, src)
+	}
+	return expr, nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given operator or keyword.
+func (p *exprParser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokOp || t.kind == tokName) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected %q, got %q", text, p.peek().text)
+	}
+	return nil
+}
+
+// parseConditional parses "a if cond else b".
+func (p *exprParser) parseConditional() (jinjaExpr, error) {
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("if") {
+		return expr, nil
+	}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	var orElse jinjaExpr = literalExpr{nil}
+	if p.accept("else") {
+		if orElse, err = p.parseConditional(); err != nil {
+			return nil, err
+		}
+	}
+	return conditionalExpr{expr, cond, orElse}, nil
+}
+
+func (p *exprParser) parseOr() (jinjaExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{"or", left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (jinjaExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{"and", left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (jinjaExpr, error) {
+	if p.accept("not") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{"not", x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (jinjaExpr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		op := ""
+		switch {
+		case t.kind == tokOp && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == ">" || t.text == "<=" || t.text == ">="):
+			op = t.text
+			p.next()
+		case t.kind == tokName && t.text == "in":
+			op = "in"
+			p.next()
+		case t.kind == tokName && t.text == "not" && p.tokens[p.pos+1].text == "in":
+			op = "not in"
+			p.pos += 2
+		case t.kind == tokName && t.text == "is":
+			p.next()
+			negate := p.accept("not")
+			name := p.next()
+			if name.kind != tokName {
+				return nil, fmt.Errorf("expected a test name after is")
+			}
+			left = testExpr{left, name.text, negate}
+			continue
+		default:
+			return left, nil
+		}
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op, left, right}
+	}
+}
+
+func (p *exprParser) parseAdditive() (jinjaExpr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "+" && t.text != "-" && t.text != "~") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{t.text, left, right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (jinjaExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "*" && t.text != "/" && t.text != "//" && t.text != "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{t.text, left, right}
+	}
+}
+
+func (p *exprParser) parseUnary() (jinjaExpr, error) {
+	if p.accept("-") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{"-", x}, nil
+	}
+	return p.parsePostfix()
+}
+
+// parsePostfix parses attribute access, indexing and filters, which bind
+// tighter than any operator.
+func (p *exprParser) parsePostfix() (jinjaExpr, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			name := p.next()
+			if name.kind != tokName && name.kind != tokNumber {
+				return nil, fmt.Errorf("expected an attribute name after .")
+			}
+			x = attrExpr{x, literalExpr{name.text}}
+		case p.accept("["):
+			idx, err := p.parseConditional()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = attrExpr{x, idx}
+		case p.accept("|"):
+			name := p.next()
+			if name.kind != tokName {
+				return nil, fmt.Errorf("expected a filter name after |")
+			}
+			args := []jinjaExpr{}
+			if p.accept("(") {
+				if args, err = p.parseList(")"); err != nil {
+					return nil, err
+				}
+			}
+			x = filterExpr{x, name.text, args}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (jinjaExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber, tokString:
+		return literalExpr{t.value}, nil
+	case tokName:
+		switch t.text {
+		case "true", "True":
+			return literalExpr{true}, nil
+		case "false", "False":
+			return literalExpr{false}, nil
+		case "none", "None", "null":
+			return literalExpr{nil}, nil
+		}
+		return nameExpr{t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.parseConditional()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return listExpr{items}, nil
+		case "{":
+			return p.parseMap()
+		}
+	}
+	if t.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+// parseList parses comma separated expressions up to the closing token.
+func (p *exprParser) parseList(closer string) ([]jinjaExpr, error) {
+	items := []jinjaExpr{}
+	for !p.accept(closer) {
+		if len(items) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if p.accept(closer) {
+				break
+			}
+		}
+		item, err := p.parseConditional()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (p *exprParser) parseMap() (jinjaExpr, error) {
+	m := mapExpr{}
+	for !p.accept("}") {
+		if len(m.keys) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if p.accept("}") {
+				break
+			}
+		}
+		key, err := p.parseConditional()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseConditional()
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, key)
+		m.values = append(m.values, value)
+	}
+	return m, nil
+}
+
+type jinjaExpr interface {
+	eval(ctx *renderContext) (interface{}, error)
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+func (e literalExpr) eval(ctx *renderContext) (interface{}, error) {
+	return e.value, nil
+}
+
+type nameExpr struct {
+	name string
+}
+
+func (e nameExpr) eval(ctx *renderContext) (interface{}, error) {
+	if v, ok := ctx.vars[e.name]; ok {
+		return v, nil
+	}
+	return undefined{e.name}, nil
+}
+
+// attrExpr is both x.name and x[index].
+type attrExpr struct {
+	x, key jinjaExpr
+}
+
+func (e attrExpr) eval(ctx *renderContext) (interface{}, error) {
+	x, err := e.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := e.key.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := x.(undefined); ok {
+		return nil, u.err()
+	}
+	if u, ok := key.(undefined); ok {
+		return nil, u.err()
+	}
+
+	switch t := x.(type) {
+	case map[string]interface{}:
+		k, err := stringify(key)
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := t[k]; ok {
+			return v, nil
+		}
+		return undefined{fmt.Sprintf("%s.%s", describeExpr(e.x), k)}, nil
+	case []interface{}:
+		var i int
+		switch k := key.(type) {
+		case float64:
+			i = int(k)
+		case string:
+			if i, err = strconv.Atoi(k); err != nil {
+				return nil, fmt.Errorf("list index must be a number, got %q", k)
+			}
+		default:
+			return nil, fmt.Errorf("list index must be a number, got %T", key)
+		}
+		if i < 0 {
+			i += len(t)
+		}
+		if i < 0 || i >= len(t) {
+			return undefined{fmt.Sprintf("%s[%d]", describeExpr(e.x), i)}, nil
+		}
+		return t[i], nil
+	}
+	return nil, fmt.Errorf("cannot access %v of %T", key, x)
+}
+
+func describeExpr(e jinjaExpr) string {
+	switch t := e.(type) {
+	case nameExpr:
+		return t.name
+	case attrExpr:
+		if k, ok := t.key.(literalExpr); ok {
+			return fmt.Sprintf("%s.%v", describeExpr(t.x), k.value)
+		}
+		return describeExpr(t.x) + "[...]"
+	}
+	return "value"
+}
+
+type listExpr struct {
+	items []jinjaExpr
+}
+
+func (e listExpr) eval(ctx *renderContext) (interface{}, error) {
+	out := make([]interface{}, len(e.items))
+	for i, item := range e.items {
+		v, err := item.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if u, ok := v.(undefined); ok {
+			return nil, u.err()
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+type mapExpr struct {
+	keys, values []jinjaExpr
+}
+
+func (e mapExpr) eval(ctx *renderContext) (interface{}, error) {
+	out := map[string]interface{}{}
+	for i := range e.keys {
+		k, err := e.keys[i].eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ks, err := stringify(k)
+		if err != nil {
+			return nil, err
+		}
+		v, err := e.values[i].eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if u, ok := v.(undefined); ok {
+			return nil, u.err()
+		}
+		out[ks] = v
+	}
+	return out, nil
+}
+
+type conditionalExpr struct {
+	then, cond, orElse jinjaExpr
+}
+
+func (e conditionalExpr) eval(ctx *renderContext) (interface{}, error) {
+	cond, err := e.cond.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if isTruthy(cond) {
+		return e.then.eval(ctx)
+	}
+	return e.orElse.eval(ctx)
+}
+
+type unaryExpr struct {
+	op string
+	x  jinjaExpr
+}
+
+func (e unaryExpr) eval(ctx *renderContext) (interface{}, error) {
+	x, err := e.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "not" {
+		return !isTruthy(x), nil
+	}
+	f, err := toNumber(x)
+	if err != nil {
+		return nil, err
+	}
+	return -f, nil
+}
+
+type binaryExpr struct {
+	op          string
+	left, right jinjaExpr
+}
+
+func (e binaryExpr) eval(ctx *renderContext) (interface{}, error) {
+	left, err := e.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "and":
+		if !isTruthy(left) {
+			return false, nil
+		}
+		right, err := e.right.eval(ctx)
+		return isTruthy(right), err
+	case "or":
+		if isTruthy(left) {
+			return true, nil
+		}
+		right, err := e.right.eval(ctx)
+		return isTruthy(right), err
+	}
+
+	right, err := e.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range []interface{}{left, right} {
+		if u, ok := v.(undefined); ok {
+			return nil, u.err()
+		}
+	}
+
+	switch e.op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	case "in":
+		return contains(right, left)
+	case "not in":
+		found, err := contains(right, left)
+		return !found, err
+	case "~":
+		l, err := stringify(left)
+		if err != nil {
+			return nil, err
+		}
+		r, err := stringify(right)
+		return l + r, err
+	case "+":
+		switch l := left.(type) {
+		case string:
+			r, err := stringify(right)
+			return l + r, err
+		case []interface{}:
+			if r, ok := right.([]interface{}); ok {
+				return append(append([]interface{}{}, l...), r...), nil
+			}
+		}
+	case "<", ">", "<=", ">=":
+		if l, ok := left.(string); ok {
+			r, ok := right.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot compare string with %T", right)
+			}
+			return compareOrdered(strings.Compare(l, r), e.op), nil
+		}
+	}
+
+	l, err := toNumber(left)
+	if err != nil {
+		return nil, err
+	}
+	r, err := toNumber(right)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/", "//", "%":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		switch e.op {
+		case "/":
+			return l / r, nil
+		case "//":
+			return float64(int64(l / r)), nil
+		}
+		return float64(int64(l) % int64(r)), nil
+	}
+	c := 0
+	if l < r {
+		c = -1
+	} else if l > r {
+		c = 1
+	}
+	return compareOrdered(c, e.op), nil
+}
+
+func compareOrdered(c int, op string) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case ">":
+		return c > 0
+	case "<=":
+		return c <= 0
+	}
+	return c >= 0
+}
+
+func toNumber(v interface{}) (float64, error) {
+	switch t := v.(type) {
+	case float64:
+		return t, nil
+	case int:
+		return float64(t), nil
+	case bool:
+		if t {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", t)
+		}
+		return f, nil
+	case undefined:
+		return 0, t.err()
+	}
+	return 0, fmt.Errorf("%T is not a number", v)
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if fa, err := toNumber(a); err == nil {
+		if _, isString := a.(string); !isString {
+			if fb, err := toNumber(b); err == nil {
+				if _, isString := b.(string); !isString {
+					return fa == fb
+				}
+			}
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func contains(container, item interface{}) (bool, error) {
+	switch t := container.(type) {
+	case string:
+		s, err := stringify(item)
+		return strings.Contains(t, s), err
+	case []interface{}:
+		for _, v := range t {
+			if valuesEqual(v, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		s, err := stringify(item)
+		_, ok := t[s]
+		return ok, err
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("cannot test membership in %T", container)
+}
+
+type testExpr struct {
+	x      jinjaExpr
+	name   string
+	negate bool
+}
+
+func (e testExpr) eval(ctx *renderContext) (interface{}, error) {
+	x, err := e.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, isUndefined := x.(undefined)
+
+	var result bool
+	switch e.name {
+	case "defined":
+		result = !isUndefined
+	case "undefined":
+		result = isUndefined
+	case "none":
+		result = x == nil
+	default:
+		if isUndefined {
+			return nil, x.(undefined).err()
+		}
+		switch e.name {
+		case "string":
+			_, result = x.(string)
+		case "number":
+			_, result = x.(float64)
+		case "mapping":
+			_, result = x.(map[string]interface{})
+		case "sequence", "iterable":
+			_, result = x.([]interface{})
+		default:
+			return nil, fmt.Errorf("unknown test %q", e.name)
+		}
+	}
+	return result != e.negate, nil
+}
+
+type filterExpr struct {
+	x    jinjaExpr
+	name string
+	args []jinjaExpr
+}
+
+func (e filterExpr) eval(ctx *renderContext) (interface{}, error) {
+	x, err := e.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(e.args))
+	for i, a := range e.args {
+		if args[i], err = a.eval(ctx); err != nil {
+			return nil, err
+		}
+		if u, ok := args[i].(undefined); ok {
+			return nil, u.err()
+		}
+	}
+
+	if e.name == "default" || e.name == "d" {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("default filter requires a value")
+		}
+		// Like Jinja, default replaces undefined values, and also falsy values
+		// when its second argument is true.
+		if _, ok := x.(undefined); ok || x == nil || len(args) > 1 && isTruthy(args[1]) && !isTruthy(x) {
+			return args[0], nil
+		}
+		return x, nil
+	}
+	if u, ok := x.(undefined); ok {
+		return nil, u.err()
+	}
+
+	arg := func(i int) (string, error) {
+		if i >= len(args) {
+			return "", fmt.Errorf("filter %s requires %d arguments", e.name, i+1)
+		}
+		return stringify(args[i])
+	}
+
+	switch e.name {
+	case "upper", "lower", "capitalize", "trim", "string", "base64", "base64Encode", "b64encode":
+		s, err := stringify(x)
+		if err != nil {
+			return nil, err
+		}
+		switch e.name {
+		case "upper":
+			return strings.ToUpper(s), nil
+		case "lower":
+			return strings.ToLower(s), nil
+		case "capitalize":
+			if s == "" {
+				return s, nil
+			}
+			return strings.ToUpper(s[:1]) + strings.ToLower(s[1:]), nil
+		case "trim":
+			return strings.TrimSpace(s), nil
+		case "string":
+			return s, nil
+		}
+		return base64.StdEncoding.EncodeToString([]byte(s)), nil
+	case "replace":
+		s, err := stringify(x)
+		if err != nil {
+			return nil, err
+		}
+		old, err := arg(0)
+		if err != nil {
+			return nil, err
+		}
+		replacement, err := arg(1)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Replace(s, old, replacement, -1), nil
+	case "split":
+		s, err := stringify(x)
+		if err != nil {
+			return nil, err
+		}
+		sep := " "
+		if len(args) > 0 {
+			if sep, err = arg(0); err != nil {
+				return nil, err
+			}
+		}
+		out := []interface{}{}
+		for _, part := range strings.Split(s, sep) {
+			out = append(out, part)
+		}
+		return out, nil
+	case "int", "float":
+		f, err := toNumber(x)
+		if err != nil {
+			return nil, err
+		}
+		if e.name == "int" {
+			return float64(int64(f)), nil
+		}
+		return f, nil
+	case "length", "count":
+		switch t := x.(type) {
+		case string:
+			return float64(len(t)), nil
+		case []interface{}:
+			return float64(len(t)), nil
+		case map[string]interface{}:
+			return float64(len(t)), nil
+		}
+		return nil, fmt.Errorf("%T has no length", x)
+	case "join":
+		list, ok := x.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("join filter requires a list, got %T", x)
+		}
+		sep := ""
+		if len(args) > 0 {
+			if sep, err = arg(0); err != nil {
+				return nil, err
+			}
+		}
+		parts := make([]string, len(list))
+		for i, item := range list {
+			if parts[i], err = stringify(item); err != nil {
+				return nil, err
+			}
+		}
+		return strings.Join(parts, sep), nil
+	case "first", "last":
+		list, ok := x.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s filter requires a list, got %T", e.name, x)
+		}
+		if len(list) == 0 {
+			return nil, nil
+		}
+		if e.name == "first" {
+			return list[0], nil
+		}
+		return list[len(list)-1], nil
+	case "json", "tojson":
+		dat, err := json.Marshal(x)
+		if err != nil {
+			return nil, err
+		}
+		return string(dat), nil
+	}
+	return nil, fmt.Errorf("unsupported filter %q", e.name)
+}
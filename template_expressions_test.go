@@ -0,0 +1,270 @@
+package roer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testRenderContext() *renderContext {
+	return &renderContext{
+		vars: map[string]interface{}{
+			"name":     "app",
+			"mixed":    "hELLO",
+			"empty":    "",
+			"nothing":  nil,
+			"n":        float64(2),
+			"waitTime": float64(5),
+			"flag":     true,
+			"regions":  []interface{}{"a", "b"},
+			"cfg": map[string]interface{}{
+				"b":      float64(2),
+				"a":      float64(1),
+				"nested": map[string]interface{}{"key": "value"},
+			},
+		},
+		modules: map[string]PipelineTemplateModule{
+			"greet": {
+				ID:         "greet",
+				Variables:  []PipelineTemplateVariable{{Name: "who", DefaultValue: "world"}},
+				Definition: "hi {{ who }}",
+			},
+			"stage": {
+				ID:         "stage",
+				Variables:  []PipelineTemplateVariable{{Name: "wait"}},
+				Definition: map[string]interface{}{"type": "wait", "waitTime": "{{ wait }}"},
+			},
+			"loop": {
+				ID:         "loop",
+				Definition: "{% module loop %}",
+			},
+		},
+	}
+}
+
+func TestRenderString(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		expected interface{}
+	}{
+		{"plain text", "no expressions", "no expressions"},
+		{"single expression keeps type", "{{ waitTime }}", float64(5)},
+		{"single expression list", "{{ regions }}", []interface{}{"a", "b"}},
+		{"expression in text", "wait {{ waitTime }}s", "wait 5s"},
+		{"attribute", "{{ cfg.nested.key }}", "value"},
+		{"index", "{{ regions[0] }}", "a"},
+		{"negative index", "{{ regions[-1] }}", "b"},
+		{"subscript key", "{{ cfg['nested']['key'] }}", "value"},
+		{"null prints empty", "[{{ nothing }}]x", "[]x"},
+
+		{"upper", "{{ name | upper }}", "APP"},
+		{"lower", "{{ mixed | lower }}", "hello"},
+		{"capitalize", "{{ mixed | capitalize }}", "Hello"},
+		{"trim", "{{ '  x  ' | trim }}", "x"},
+		{"replace", "{{ name | replace('a', 'o') }}", "opp"},
+		{"split", "{{ 'a,b' | split(',') }}", []interface{}{"a", "b"}},
+		{"join", "{{ regions | join(',') }}", "a,b"},
+		{"length", "{{ regions | length }}", float64(2)},
+		{"string length", "{{ name | length }}", float64(3)},
+		{"first", "{{ regions | first }}", "a"},
+		{"last", "{{ regions | last }}", "b"},
+		{"int", "{{ '3' | int + 1 }}", float64(4)},
+		{"int truncates", "{{ 3.7 | int }}", float64(3)},
+		{"float", "{{ '1.5' | float }}", 1.5},
+		{"json", "{{ cfg.nested | json }}", `{"key":"value"}`},
+		{"base64", "{{ name | b64encode }}", "YXBw"},
+		{"chained filters", "{{ mixed | lower | capitalize }}", "Hello"},
+		{"default on undefined", "{{ missing | default('x') }}", "x"},
+		{"default on null", "{{ nothing | default('x') }}", "x"},
+		{"default keeps empty string", "{{ empty | default('x') }}", ""},
+		{"default boolean replaces falsy", "{{ empty | default('x', true) }}", "x"},
+		{"default keeps defined", "{{ name | default('x') }}", "app"},
+		{"default on undefined attribute", "{{ cfg.nope | default(1) }}", float64(1)},
+
+		{"defined", "{{ name is defined }}", true},
+		{"undefined", "{{ missing is defined }}", false},
+		{"undefined test", "{{ missing is undefined }}", true},
+		{"undefined attribute test", "{{ cfg.nope is defined }}", false},
+		{"none", "{{ nothing is none }}", true},
+		{"string", "{{ name is string }}", true},
+		{"not number", "{{ name is not number }}", true},
+		{"mapping", "{{ cfg is mapping }}", true},
+		{"sequence", "{{ regions is sequence }}", true},
+
+		{"arithmetic precedence", "{{ 1 + 2 * 3 }}", float64(7)},
+		{"parentheses", "{{ (1 + 2) * 3 }}", float64(9)},
+		{"division", "{{ 7 / 2 }}", 3.5},
+		{"floor division", "{{ 7 // 2 }}", float64(3)},
+		{"modulo", "{{ 7 % 3 }}", float64(1)},
+		{"unary minus", "{{ -n + 1 }}", float64(-1)},
+		{"concatenation", "{{ 'a' ~ 1 }}", "a1"},
+		{"string plus", "{{ name + '-x' }}", "app-x"},
+		{"list plus", "{{ regions + ['c'] }}", []interface{}{"a", "b", "c"}},
+		{"equality", "{{ n == 2 }}", true},
+		{"inequality", "{{ name != 'app' }}", false},
+		{"ordering", "{{ n >= 2 and n < 3 }}", true},
+		{"string ordering", "{{ 'abc' < 'abd' }}", true},
+		{"in list", "{{ 'a' in regions }}", true},
+		{"not in list", "{{ 'c' not in regions }}", true},
+		{"in string", "{{ 'pp' in name }}", true},
+		{"in mapping", "{{ 'nested' in cfg }}", true},
+		{"not", "{{ not flag }}", false},
+		{"or short circuits", "{{ flag or missing }}", true},
+		{"and short circuits", "{{ not flag and missing }}", false},
+		{"conditional", "{{ 'x' if flag else 'y' }}", "x"},
+		{"conditional else", "{{ 'x' if n > 5 else 'y' }}", "y"},
+		{"list literal", "{{ [1, 'a'] }}", []interface{}{float64(1), "a"}},
+		{"map literal", "{{ {'a': n} }}", map[string]interface{}{"a": float64(2)}},
+
+		{"if", "{% if flag %}yes{% else %}no{% endif %}", "yes"},
+		{"if false", "{% if not flag %}yes{% else %}no{% endif %}", "no"},
+		{"elif", "{% if n > 3 %}big{% elif n > 1 %}mid{% else %}small{% endif %}", "mid"},
+		{"if without else", "a{% if not flag %}b{% endif %}c", "ac"},
+		{"if undefined guarded", "{% if missing is defined %}{{ missing }}{% endif %}ok", "ok"},
+		{"for", "{% for r in regions %}{{ loop.index }}:{{ r }}{% if not loop.last %},{% endif %}{% endfor %}", "1:a,2:b"},
+		{"for index0 and length", "{% for r in regions %}{{ loop.index0 }}/{{ loop.length }} {% endfor %}", "0/2 1/2 "},
+		{"for first", "{% for r in regions %}{% if loop.first %}{{ r }}{% endif %}{% endfor %}", "a"},
+		{"for over mapping sorts keys", "{% for k, v in cfg %}{% if v is number %}{{ k }}={{ v }};{% endif %}{% endfor %}", "a=1;b=2;"},
+		{"for over mapping yields keys", "{% for k in cfg %}{{ k }} {% endfor %}", "a b nested "},
+		{"for over null", "{% for r in nothing %}x{% endfor %}done", "done"},
+		{"nested for", "{% for a in regions %}{% for b in regions %}{{ a }}{{ b }} {% endfor %}{% endfor %}", "aa ab ba bb "},
+		{"loop variable shadows", "{% for name in regions %}{{ name }}{% endfor %}{{ name }}", "abapp"},
+		{"rendered list is decoded", "[{% for r in regions %}'{{ r }}'{% if not loop.last %}, {% endif %}{% endfor %}]", []interface{}{"a", "b"}},
+		{"rendered object is decoded", "{ name: {{ name }} }", map[string]interface{}{"name": "app"}},
+		{"whitespace control", "a {%- if flag %} b{% endif -%} \n c", "a bc"},
+		{"comment", "{# note #}x", "x"},
+
+		{"module", "{% module greet who='you' %}", "hi you"},
+		{"module default", "{% module greet %}", "hi world"},
+		{"module argument expression", "{% module greet who=name %}", "hi app"},
+		{"module keeps type", "{% module stage wait=waitTime %}", map[string]interface{}{"type": "wait", "waitTime": float64(5)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := renderString(c.template, testRenderContext())
+			if err != nil {
+				t.Fatalf("rendering %q: %v", c.template, err)
+			}
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("rendering %q: expected %#v, got %#v", c.template, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRenderStringErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		err      string
+	}{
+		{"undefined variable", "{{ missing }}", "undefined variable missing"},
+		{"undefined variable in text", "x {{ missing }}", "undefined variable missing"},
+		{"undefined attribute", "{{ cfg.nope }}", "undefined variable cfg.nope"},
+		{"attribute of undefined", "{{ missing.key }}", "undefined variable missing"},
+		{"filter on undefined", "{{ missing | upper }}", "undefined variable missing"},
+		{"undefined filter argument", "{{ name | default(missing) }}", "undefined variable missing"},
+		{"undefined in comparison", "{{ missing == 1 }}", "undefined variable missing"},
+		{"undefined in condition", "{% if missing > 1 %}x{% endif %}", "undefined variable missing"},
+		{"undefined loop", "{% for r in missing %}{% endfor %}", "undefined variable missing"},
+		{"loop variable out of scope", "{% for r in regions %}{% endfor %}{{ r }}", "undefined variable r"},
+		{"undefined module argument", "{% module greet who=missing %}", "undefined variable missing"},
+		{"module variable out of scope", "{% module greet %}{{ who }}", "undefined variable who"},
+		{"missing module variable", "{% module stage %}", "missing values for variables: wait"},
+		{"undefined module", "{% module nope %}", "module nope is not defined"},
+		{"recursive module", "{% module loop %}", "nested too deeply"},
+		{"division by zero", "{{ 1 / 0 }}", "division by zero"},
+		{"unsupported filter", "{{ name | nosuch }}", `unsupported filter "nosuch"`},
+		{"unknown test", "{{ name is weird }}", `unknown test "weird"`},
+		{"compare string with number", "{{ name < 1 }}", "cannot compare"},
+		{"join non-list", "{{ name | join(',') }}", "join filter requires a list"},
+		{"unclosed if", "{% if flag %}x", "parsing"},
+		{"unclosed expression", "{{ name", "parsing"},
+		{"unbalanced endfor", "x{% endfor %}", "parsing"},
+		{"bad syntax", "{{ name | }}", "parsing"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := renderString(c.template, testRenderContext())
+			if err == nil {
+				t.Fatalf("rendering %q: expected an error containing %q, got %#v", c.template, c.err, actual)
+			}
+			if !strings.Contains(err.Error(), c.err) {
+				t.Errorf("rendering %q: expected an error containing %q, got %q", c.template, c.err, err)
+			}
+		})
+	}
+}
+
+func TestRenderTree(t *testing.T) {
+	tree := map[string]interface{}{
+		"waitTime": "{{ waitTime }}",
+		"list":     []interface{}{"{{ name }}", float64(1), true},
+		"nested":   map[string]interface{}{"text": "{{ name | upper }}-{{ n }}"},
+		"literal":  nil,
+	}
+	actual, err := renderTree(tree, testRenderContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"waitTime": float64(5),
+		"list":     []interface{}{"app", float64(1), true},
+		"nested":   map[string]interface{}{"text": "APP-2"},
+		"literal":  nil,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, got %#v", expected, actual)
+	}
+	if tree["waitTime"] != "{{ waitTime }}" {
+		t.Errorf("rendering modified the input tree: %#v", tree)
+	}
+}
+
+func TestResolveVariables(t *testing.T) {
+	declared := []PipelineTemplateVariable{
+		{Name: "required"},
+		{Name: "withDefault", DefaultValue: "d"},
+		{Name: "nullable", Nullable: true},
+	}
+
+	vars, err := resolveVariables(declared, map[string]interface{}{"required": "r", "extra": "e"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"required": "r", "withDefault": "d", "nullable": nil, "extra": "e"}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Errorf("expected %#v, got %#v", expected, vars)
+	}
+
+	if _, err := resolveVariables(declared, map[string]interface{}{}); err == nil || !strings.Contains(err.Error(), "required") {
+		t.Errorf("expected an error for the missing required variable, got %v", err)
+	}
+}
+
+func TestIsTruthy(t *testing.T) {
+	cases := []struct {
+		value    interface{}
+		expected bool
+	}{
+		{nil, false},
+		{undefined{"x"}, false},
+		{false, false},
+		{true, true},
+		{float64(0), false},
+		{float64(1), true},
+		{"", false},
+		{"false", false},
+		{"x", true},
+		{[]interface{}{}, false},
+		{[]interface{}{1}, true},
+		{map[string]interface{}{}, false},
+		{map[string]interface{}{"a": 1}, true},
+	}
+	for _, c := range cases {
+		if actual := isTruthy(c.value); actual != c.expected {
+			t.Errorf("isTruthy(%#v): expected %v, got %v", c.value, c.expected, actual)
+		}
+	}
+}
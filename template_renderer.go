@@ -0,0 +1,688 @@
+package roer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// renderPipeline renders a pipeline template configuration and its template
+// to the pipeline Orca would plan for them, without contacting Spinnaker. It
+// follows Orca's MPT v1 processing: variables are resolved, configuration
+// stages replace or are injected into the template stages, stages are rendered
+// and filtered by their when conditions, and partials are expanded into the
+// stage graph. Like Orca, it refuses configurations that fail validation,
+// returning a *templateInvalidError with the plan errors Orca would report.
+func renderPipeline(config PipelineConfiguration, template PipelineTemplate) (map[string]interface{}, error) {
+	if resp := checkPipelineTemplate(template, config); resp != nil && planFailed(resp, "fatal") {
+		return nil, &templateInvalidError{resp: resp}
+	}
+
+	modules := map[string]PipelineTemplateModule{}
+	for _, m := range append(append([]PipelineTemplateModule{}, template.Modules...), config.Modules...) {
+		modules[m.ID] = m
+	}
+	partials := map[string]PipelineTemplatePartial{}
+	for _, p := range append(append([]PipelineTemplatePartial{}, template.Partials...), config.Partials...) {
+		partials[p.ID] = p
+	}
+
+	vars, err := resolveVariables(template.Variables, config.Pipeline.Variables)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range map[string]interface{}{
+		"application":      config.Pipeline.Application,
+		"pipelineConfigId": config.Pipeline.PipelineConfigID,
+		"trigger":          map[string]interface{}{},
+	} {
+		if _, ok := vars[k]; !ok {
+			vars[k] = v
+		}
+	}
+	ctx := &renderContext{vars: vars, modules: modules}
+
+	nodes, err := mergeStages(template.Stages, config.Stages)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err = buildStageGraph(nodes, ctx, partials)
+	if err != nil {
+		return nil, err
+	}
+	stages := make([]interface{}, len(nodes))
+	for i, n := range nodes {
+		stages[i] = n.toStage()
+	}
+
+	pipeline, err := renderPipelineConfiguration(config, template, ctx)
+	if err != nil {
+		return nil, err
+	}
+	pipeline["stages"] = stages
+	return pipeline, nil
+}
+
+// renderPipelineConfiguration renders the pipeline level settings. The
+// template configuration is only used for the sections the pipeline
+// configuration inherits; the configuration's own triggers, parameters and so
+// on are added to the inherited ones.
+func renderPipelineConfiguration(config PipelineConfiguration, template PipelineTemplate, ctx *renderContext) (map[string]interface{}, error) {
+	inherit := map[string]bool{}
+	for _, i := range config.Configuration.Inherit {
+		inherit[i] = true
+	}
+
+	concurrent := map[string]bool{"limitConcurrent": true, "keepWaitingPipelines": false}
+	if inherit["concurrentExecutions"] {
+		for k, v := range template.Configuration.ConcurrentExecutions {
+			concurrent[k] = v
+		}
+	}
+	for k, v := range config.Configuration.ConcurrentExecutions {
+		concurrent[k] = v
+	}
+
+	id := config.Pipeline.PipelineConfigID
+	if id == "" {
+		id = "unknown"
+	}
+	pipeline := map[string]interface{}{
+		"application":          config.Pipeline.Application,
+		"name":                 config.Pipeline.Name,
+		"id":                   id,
+		"limitConcurrent":      concurrent["limitConcurrent"],
+		"keepWaitingPipelines": concurrent["keepWaitingPipelines"],
+	}
+	if config.Configuration.Description != "" {
+		pipeline["description"] = config.Configuration.Description
+	}
+
+	sections := []struct {
+		name, key string
+		template  []map[string]interface{}
+		config    []interface{}
+	}{
+		{"triggers", "triggers", template.Configuration.Triggers, config.Configuration.Triggers},
+		{"parameters", "parameterConfig", template.Configuration.Parameters, config.Configuration.Parameters},
+		{"notifications", "notifications", template.Configuration.Notifications, config.Configuration.Notifications},
+		{"expectedArtifacts", "expectedArtifacts", template.Configuration.ExpectedArtifacts, config.Configuration.ExpectedArtifacts},
+	}
+	for _, s := range sections {
+		items := []interface{}{}
+		if inherit[s.name] {
+			for _, item := range s.template {
+				items = append(items, item)
+			}
+		}
+		items = append(items, s.config...)
+		rendered, err := renderTree(items, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("rendering %s: %v", s.name, err)
+		}
+		pipeline[s.key] = rendered
+	}
+	return pipeline, nil
+}
+
+// stageNode is a stage while the stage graph is being built.
+type stageNode struct {
+	id            string
+	stageType     string
+	name          string
+	dependsOn     []string
+	inject        PipelineTemplateStageInjection
+	when          []string
+	config        map[string]interface{}
+	notifications []map[string]interface{}
+	comments      string
+	control       *PipelineTemplateStageInheritanceControl
+	included      bool
+	location      string
+}
+
+// newStageNode creates the node of a stage defined at the given location, such
+// as template:stages, which locates its render errors.
+func newStageNode(s PipelineTemplateStage, location string) *stageNode {
+	return &stageNode{
+		id:            s.ID,
+		stageType:     s.Type,
+		name:          s.Name,
+		dependsOn:     append([]string{}, s.DependsOn...),
+		inject:        s.Inject,
+		when:          s.When,
+		config:        s.Config,
+		notifications: s.Notifications,
+		comments:      s.Comments,
+		included:      true,
+		location:      location + "." + s.ID,
+	}
+}
+
+func (n *stageNode) injected() bool {
+	return n.inject.First || n.inject.Last || len(n.inject.Before) > 0 || len(n.inject.After) > 0
+}
+
+func (n *stageNode) toStage() map[string]interface{} {
+	stage := map[string]interface{}{}
+	for k, v := range n.config {
+		stage[k] = v
+	}
+	stage["refId"] = n.id
+	stage["type"] = n.stageType
+	stage["name"] = n.name
+	stage["requisiteStageRefIds"] = append([]string{}, n.dependsOn...)
+	if len(n.notifications) > 0 {
+		stage["notifications"] = n.notifications
+		stage["sendNotifications"] = true
+	}
+	if n.comments != "" {
+		stage["comments"] = n.comments
+	}
+	return stage
+}
+
+// mergeStages combines the template stages with the configuration stages. A
+// configuration stage with the id of a template stage replaces it, keeping its
+// place in the graph unless it declares its own dependencies. A configuration
+// stage without a type only modifies the template stage through its
+// inheritanceControl rules. Other configuration stages are added.
+func mergeStages(templateStages, configStages []PipelineTemplateStage) ([]*stageNode, error) {
+	nodes := []*stageNode{}
+	byID := map[string]*stageNode{}
+	for _, s := range templateStages {
+		if _, ok := byID[s.ID]; ok {
+			return nil, fmt.Errorf("duplicate template stage id %s", s.ID)
+		}
+		n := newStageNode(s, "template:stages")
+		nodes = append(nodes, n)
+		byID[s.ID] = n
+	}
+
+	for _, s := range configStages {
+		control := s.InheritanceControl
+		existing, ok := byID[s.ID]
+		switch {
+		case ok && s.Type == "":
+			existing.control = &control
+		case ok:
+			n := newStageNode(s, "configuration:stages")
+			if len(n.dependsOn) == 0 && !n.injected() {
+				n.dependsOn, n.inject = existing.dependsOn, existing.inject
+			}
+			n.control = &control
+			*existing = *n
+		case s.Type == "":
+			return nil, fmt.Errorf("configuration stage %s has no type and does not match a template stage", s.ID)
+		default:
+			n := newStageNode(s, "configuration:stages")
+			n.control = &control
+			nodes = append(nodes, n)
+			byID[s.ID] = n
+		}
+	}
+	return nodes, nil
+}
+
+// buildStageGraph renders the stages, resolves their dependencies and
+// injection rules, drops the stages whose when conditions are false and
+// expands partials.
+func buildStageGraph(nodes []*stageNode, ctx *renderContext, partials map[string]PipelineTemplatePartial) ([]*stageNode, error) {
+	byID := map[string]*stageNode{}
+	for _, n := range nodes {
+		if _, ok := byID[n.id]; ok {
+			return nil, fmt.Errorf("duplicate stage id %s", n.id)
+		}
+		byID[n.id] = n
+		if err := n.render(ctx); err != nil {
+			return nil, renderFailure(n.location, err)
+		}
+	}
+
+	if err := injectStages(nodes, byID); err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		for _, d := range n.dependsOn {
+			if _, ok := byID[d]; !ok {
+				return nil, fmt.Errorf("stage %s depends on unknown stage %s", n.id, d)
+			}
+		}
+	}
+	if err := checkStageCycles(nodes, byID); err != nil {
+		return nil, err
+	}
+
+	removed := map[string]bool{}
+	for _, n := range nodes {
+		if !n.included {
+			removed[n.id] = true
+		}
+	}
+	nodes = removeStages(nodes, byID, removed)
+
+	return expandPartials(nodes, ctx, partials)
+}
+
+// render renders the stage name, config and conditions. Partial stages keep
+// their config, which holds the partial variables.
+func (n *stageNode) render(ctx *renderContext) error {
+	name, err := renderString(n.name, ctx)
+	if err != nil {
+		return err
+	}
+	if n.name, err = stringify(name); err != nil {
+		return err
+	}
+	if n.name == "" {
+		n.name = n.id
+	}
+
+	config, err := renderTree(map[string]interface{}(n.config), ctx)
+	if err != nil {
+		return err
+	}
+	n.config = config.(map[string]interface{})
+	if n.control != nil {
+		if err := applyInheritanceControl(n.config, *n.control, ctx); err != nil {
+			return err
+		}
+	}
+
+	for i, notification := range n.notifications {
+		rendered, err := renderTree(map[string]interface{}(notification), ctx)
+		if err != nil {
+			return err
+		}
+		n.notifications[i] = rendered.(map[string]interface{})
+	}
+
+	for _, condition := range n.when {
+		v, err := renderString(condition, ctx)
+		if err != nil {
+			return fmt.Errorf("when condition %q: %v", condition, err)
+		}
+		if !isTruthy(v) {
+			n.included = false
+		}
+	}
+	return nil
+}
+
+// injectStages rewires the graph for stages with inject rules, which place a
+// stage first, last, or before or after other stages instead of declaring
+// dependsOn.
+func injectStages(nodes []*stageNode, byID map[string]*stageNode) error {
+	for _, n := range nodes {
+		if !n.injected() {
+			continue
+		}
+		rules := 0
+		for _, set := range []bool{n.inject.First, n.inject.Last, len(n.inject.Before) > 0, len(n.inject.After) > 0} {
+			if set {
+				rules++
+			}
+		}
+		if rules > 1 {
+			return fmt.Errorf("stage %s has more than one inject rule", n.id)
+		}
+		if len(n.dependsOn) > 0 {
+			return fmt.Errorf("stage %s has both dependsOn and an inject rule", n.id)
+		}
+		for _, target := range append(append([]string{}, n.inject.Before...), n.inject.After...) {
+			if _, ok := byID[target]; !ok {
+				return fmt.Errorf("stage %s is injected relative to unknown stage %s", n.id, target)
+			}
+		}
+
+		switch {
+		case n.inject.First:
+			for _, other := range nodes {
+				if other != n && len(other.dependsOn) == 0 && !other.injected() {
+					other.dependsOn = []string{n.id}
+				}
+			}
+		case n.inject.Last:
+			n.dependsOn = leafStages(nodes, n)
+		case len(n.inject.Before) > 0:
+			deps := []string{}
+			for _, target := range n.inject.Before {
+				deps = appendUnique(deps, byID[target].dependsOn...)
+				byID[target].dependsOn = []string{n.id}
+			}
+			n.dependsOn = deps
+		default:
+			targets := map[string]bool{}
+			for _, target := range n.inject.After {
+				targets[target] = true
+			}
+			for _, other := range nodes {
+				if other == n {
+					continue
+				}
+				deps := []string{}
+				for _, d := range other.dependsOn {
+					if targets[d] {
+						d = n.id
+					}
+					deps = appendUnique(deps, d)
+				}
+				other.dependsOn = deps
+			}
+			n.dependsOn = append([]string{}, n.inject.After...)
+		}
+	}
+	return nil
+}
+
+// leafStages returns the stages no other stage depends on, except for the
+// given stage.
+func leafStages(nodes []*stageNode, except *stageNode) []string {
+	required := map[string]bool{}
+	for _, n := range nodes {
+		for _, d := range n.dependsOn {
+			required[d] = true
+		}
+	}
+	leaves := []string{}
+	for _, n := range nodes {
+		if n != except && !required[n.id] {
+			leaves = append(leaves, n.id)
+		}
+	}
+	return leaves
+}
+
+func checkStageCycles(nodes []*stageNode, byID map[string]*stageNode) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var visit func(n *stageNode, path []string) error
+	visit = func(n *stageNode, path []string) error {
+		switch state[n.id] {
+		case visiting:
+			return fmt.Errorf("stage dependency cycle: %s", strings.Join(append(path, n.id), " -> "))
+		case done:
+			return nil
+		}
+		state[n.id] = visiting
+		for _, d := range n.dependsOn {
+			if err := visit(byID[d], append(path, n.id)); err != nil {
+				return err
+			}
+		}
+		state[n.id] = done
+		return nil
+	}
+	for _, n := range nodes {
+		if err := visit(n, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeStages drops stages from the graph. Stages depending on a dropped
+// stage depend on its dependencies instead, so the graph stays connected.
+func removeStages(nodes []*stageNode, byID map[string]*stageNode, removed map[string]bool) []*stageNode {
+	if len(removed) == 0 {
+		return nodes
+	}
+	var resolve func(id string) []string
+	resolve = func(id string) []string {
+		if !removed[id] {
+			return []string{id}
+		}
+		deps := []string{}
+		for _, d := range byID[id].dependsOn {
+			deps = appendUnique(deps, resolve(d)...)
+		}
+		return deps
+	}
+
+	kept := []*stageNode{}
+	for _, n := range nodes {
+		if removed[n.id] {
+			continue
+		}
+		deps := []string{}
+		for _, d := range n.dependsOn {
+			deps = appendUnique(deps, resolve(d)...)
+		}
+		n.dependsOn = deps
+		kept = append(kept, n)
+	}
+	return kept
+}
+
+// expandPartials replaces every partial stage, whose type is partial.<id>,
+// with the stages of the partial. The stages are prefixed with the id of the
+// partial stage and rendered with the partial variables, which are taken from
+// the partial stage config. The first stages of the partial inherit the
+// dependencies of the partial stage, and stages depending on the partial
+// stage depend on its last stages.
+func expandPartials(nodes []*stageNode, ctx *renderContext, partials map[string]PipelineTemplatePartial) ([]*stageNode, error) {
+	expanded := []*stageNode{}
+	replacements := map[string][]string{}
+	for _, n := range nodes {
+		if !strings.HasPrefix(n.stageType, "partial.") {
+			expanded = append(expanded, n)
+			continue
+		}
+		partialID := strings.TrimPrefix(n.stageType, "partial.")
+		partial, ok := partials[partialID]
+		if !ok {
+			return nil, fmt.Errorf("stage %s uses undefined partial %s", n.id, partialID)
+		}
+		if ctx.depth >= maxRenderDepth {
+			return nil, fmt.Errorf("partial %s is nested too deeply", partialID)
+		}
+
+		vars, err := resolveVariables(partial.Variables, n.config)
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: partial %s: %v", n.id, partialID, err)
+		}
+		partialCtx := ctx.with(vars)
+		partialCtx.depth++
+
+		prefix := func(ids []string) []string {
+			out := make([]string, len(ids))
+			for i, id := range ids {
+				out[i] = n.id + "." + id
+			}
+			return out
+		}
+		inner := []*stageNode{}
+		for _, s := range partial.Stages {
+			child := newStageNode(s, "template:partials."+partialID+".stages")
+			child.id = n.id + "." + s.ID
+			child.dependsOn = prefix(s.DependsOn)
+			child.inject.Before = prefix(s.Inject.Before)
+			child.inject.After = prefix(s.Inject.After)
+			inner = append(inner, child)
+		}
+		inner, err = buildStageGraph(inner, partialCtx, partials)
+		if _, ok := err.(*templateInvalidError); ok {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: partial %s: %v", n.id, partialID, err)
+		}
+
+		for _, child := range inner {
+			if len(child.dependsOn) == 0 {
+				child.dependsOn = append([]string{}, n.dependsOn...)
+			}
+		}
+		replacements[n.id] = leafStages(inner, nil)
+		if len(inner) == 0 {
+			replacements[n.id] = n.dependsOn
+		}
+		expanded = append(expanded, inner...)
+	}
+
+	if len(replacements) == 0 {
+		return expanded, nil
+	}
+	var resolve func(id string) []string
+	resolve = func(id string) []string {
+		r, ok := replacements[id]
+		if !ok {
+			return []string{id}
+		}
+		deps := []string{}
+		for _, d := range r {
+			deps = appendUnique(deps, resolve(d)...)
+		}
+		return deps
+	}
+	for _, n := range expanded {
+		deps := []string{}
+		for _, d := range n.dependsOn {
+			deps = appendUnique(deps, resolve(d)...)
+		}
+		n.dependsOn = deps
+	}
+	return expanded, nil
+}
+
+// applyInheritanceControl applies the merge, replace and remove rules of a
+// configuration stage to the inherited stage config. Paths are dotted keys,
+// optionally starting with "$.".
+func applyInheritanceControl(config map[string]interface{}, control PipelineTemplateStageInheritanceControl, ctx *renderContext) error {
+	for _, rule := range control.Merge {
+		value, err := renderTree(rule.Value, ctx)
+		if err != nil {
+			return err
+		}
+		parent, key, err := controlTarget(config, rule.Path)
+		if err != nil {
+			return err
+		}
+		switch existing := parent[key].(type) {
+		case nil:
+			parent[key] = value
+		case []interface{}:
+			if items, ok := value.([]interface{}); ok {
+				parent[key] = append(existing, items...)
+			} else {
+				parent[key] = append(existing, value)
+			}
+		case map[string]interface{}:
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("cannot merge %T into the object at %s", value, rule.Path)
+			}
+			for k, v := range m {
+				existing[k] = v
+			}
+		default:
+			return fmt.Errorf("cannot merge into %T at %s, use replace instead", existing, rule.Path)
+		}
+	}
+	for _, rule := range control.Replace {
+		value, err := renderTree(rule.Value, ctx)
+		if err != nil {
+			return err
+		}
+		parent, key, err := controlTarget(config, rule.Path)
+		if err != nil {
+			return err
+		}
+		parent[key] = value
+	}
+	for _, rule := range control.Remove {
+		parent, key, err := controlTarget(config, rule.Path)
+		if err != nil {
+			return err
+		}
+		delete(parent, key)
+	}
+	return nil
+}
+
+// controlTarget returns the object holding the key an inheritance control path
+// refers to, creating intermediate objects as needed. Path segments may index
+// into lists, as in $.clusters[0].capacity, but must end with an object key.
+func controlTarget(config map[string]interface{}, path string) (map[string]interface{}, string, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, "", fmt.Errorf("inheritance control rule has no path")
+	}
+	keys := strings.Split(path, ".")
+	parent := config
+	for _, segment := range keys[:len(keys)-1] {
+		k, indexes, err := parsePathSegment(segment)
+		if err != nil {
+			return nil, "", fmt.Errorf("%v in path %s", err, path)
+		}
+		child, ok := parent[k]
+		if !ok && len(indexes) == 0 {
+			child = map[string]interface{}{}
+			parent[k] = child
+		}
+		for _, i := range indexes {
+			list, ok := child.([]interface{})
+			if !ok || i >= len(list) {
+				return nil, "", fmt.Errorf("%s in path %s is not an item of a list", segment, path)
+			}
+			child = list[i]
+		}
+		m, ok := child.(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("%s in path %s is not an object", segment, path)
+		}
+		parent = m
+	}
+	key, indexes, err := parsePathSegment(keys[len(keys)-1])
+	if err != nil {
+		return nil, "", fmt.Errorf("%v in path %s", err, path)
+	}
+	if len(indexes) > 0 {
+		return nil, "", fmt.Errorf("path %s must end with an object key, not a list item", path)
+	}
+	return parent, key, nil
+}
+
+// parsePathSegment splits a path segment such as clusters[0] into its key and
+// list indexes.
+func parsePathSegment(segment string) (string, []int, error) {
+	open := strings.Index(segment, "[")
+	if open < 0 {
+		return segment, nil, nil
+	}
+	key, rest := segment[:open], segment[open:]
+	indexes := []int{}
+	for rest != "" {
+		end := strings.Index(rest, "]")
+		if rest[0] != '[' || end < 0 {
+			return "", nil, fmt.Errorf("malformed segment %s", segment)
+		}
+		i, err := strconv.Atoi(rest[1:end])
+		if err != nil || i < 0 {
+			return "", nil, fmt.Errorf("malformed index in segment %s", segment)
+		}
+		indexes = append(indexes, i)
+		rest = rest[end+1:]
+	}
+	return key, indexes, nil
+}
+
+// appendUnique appends the values that are not in the list yet.
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, existing := range list {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
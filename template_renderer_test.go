@@ -0,0 +1,537 @@
+package roer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+const testTemplate = `
+schema: "1"
+id: test
+variables:
+- name: waitTime
+  defaultValue: 10
+- name: regions
+  defaultValue: [us-east-1]
+- name: skipVerify
+  defaultValue: false
+stages:
+- id: bake
+  type: bake
+  config:
+    regions: "{{ regions }}"
+- id: deploy
+  type: deploy
+  dependsOn: [bake]
+  config:
+    clusters:
+    - account: test
+      capacity: {min: 1, max: 1}
+- id: verify
+  type: partial.verify
+  dependsOn: [deploy]
+  when:
+  - "{{ not skipVerify }}"
+  config:
+    wait: "{{ waitTime }}"
+partials:
+- id: verify
+  variables:
+  - name: wait
+  stages:
+  - id: wait
+    type: wait
+    config:
+      waitTime: "{{ wait }}"
+  - id: check
+    type: checkPreconditions
+    dependsOn: [wait]
+    config: {}
+`
+
+func renderTestPipeline(t *testing.T, template, config string) (map[string]interface{}, error) {
+	var tmpl PipelineTemplate
+	if err := yaml.Unmarshal([]byte(template), &tmpl); err != nil {
+		t.Fatalf("decoding template: %v", err)
+	}
+	var cfg PipelineConfiguration
+	if err := yaml.Unmarshal([]byte(config), &cfg); err != nil {
+		t.Fatalf("decoding configuration: %v", err)
+	}
+	return renderPipeline(cfg, tmpl)
+}
+
+// testConfig returns a configuration of testTemplate for the app application.
+// Lines of extra indented by two spaces belong to its pipeline section.
+func testConfig(extra string) string {
+	return `
+schema: "1"
+pipeline:
+  application: app
+  name: test` + extra
+}
+
+// stageGraph describes the rendered stages as "refId<-requisiteStageRefIds".
+func stageGraph(pipeline map[string]interface{}) []string {
+	graph := []string{}
+	for _, s := range pipeline["stages"].([]interface{}) {
+		stage := s.(map[string]interface{})
+		graph = append(graph, stage["refId"].(string)+"<-"+strings.Join(stage["requisiteStageRefIds"].([]string), ","))
+	}
+	return graph
+}
+
+func renderedStage(pipeline map[string]interface{}, refID string) map[string]interface{} {
+	for _, s := range pipeline["stages"].([]interface{}) {
+		if stage := s.(map[string]interface{}); stage["refId"] == refID {
+			return stage
+		}
+	}
+	return nil
+}
+
+func TestRenderPipelineStageGraph(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		graph  []string
+	}{
+		{
+			name: "template stages and partials",
+			graph: []string{
+				"bake<-", "deploy<-bake", "verify.wait<-deploy", "verify.check<-verify.wait",
+			},
+		},
+		{
+			name: "when condition drops the partial",
+			config: `
+  variables: {skipVerify: true}`,
+			graph: []string{"bake<-", "deploy<-bake"},
+		},
+		{
+			name: "dependsOn",
+			config: `
+stages:
+- id: notify
+  type: wait
+  dependsOn: [deploy]
+  config: {}`,
+			graph: []string{
+				"bake<-", "deploy<-bake", "verify.wait<-deploy", "verify.check<-verify.wait", "notify<-deploy",
+			},
+		},
+		{
+			name: "dependsOn a partial depends on its last stages",
+			config: `
+stages:
+- id: notify
+  type: wait
+  dependsOn: [verify]
+  config: {}`,
+			graph: []string{
+				"bake<-", "deploy<-bake", "verify.wait<-deploy", "verify.check<-verify.wait", "notify<-verify.check",
+			},
+		},
+		{
+			name: "inject first",
+			config: `
+stages:
+- id: start
+  type: wait
+  inject: {first: true}
+  config: {}`,
+			graph: []string{
+				"bake<-start", "deploy<-bake", "verify.wait<-deploy", "verify.check<-verify.wait", "start<-",
+			},
+		},
+		{
+			name: "inject last",
+			config: `
+stages:
+- id: end
+  type: wait
+  inject: {last: true}
+  config: {}`,
+			graph: []string{
+				"bake<-", "deploy<-bake", "verify.wait<-deploy", "verify.check<-verify.wait", "end<-verify.check",
+			},
+		},
+		{
+			name: "inject before",
+			config: `
+stages:
+- id: approve
+  type: manualJudgment
+  inject: {before: [deploy]}
+  config: {}`,
+			graph: []string{
+				"bake<-", "deploy<-approve", "verify.wait<-deploy", "verify.check<-verify.wait", "approve<-bake",
+			},
+		},
+		{
+			name: "inject after",
+			config: `
+stages:
+- id: smoke
+  type: wait
+  inject: {after: [bake]}
+  config: {}`,
+			graph: []string{
+				"bake<-", "deploy<-smoke", "verify.wait<-deploy", "verify.check<-verify.wait", "smoke<-bake",
+			},
+		},
+		{
+			name: "replaced stage keeps its place",
+			config: `
+stages:
+- id: deploy
+  type: wait
+  config: {}`,
+			graph: []string{
+				"bake<-", "deploy<-bake", "verify.wait<-deploy", "verify.check<-verify.wait",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pipeline, err := renderTestPipeline(t, testTemplate, testConfig(c.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if graph := stageGraph(pipeline); !reflect.DeepEqual(graph, c.graph) {
+				t.Errorf("expected stages %v, got %v", c.graph, graph)
+			}
+		})
+	}
+}
+
+func TestRenderPipelineStageConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   string
+		refID    string
+		key      string
+		expected interface{}
+	}{
+		{
+			name:     "variable default",
+			refID:    "verify.wait",
+			key:      "waitTime",
+			expected: float64(10),
+		},
+		{
+			name: "variable value",
+			config: `
+  variables: {waitTime: 30}`,
+			refID:    "verify.wait",
+			key:      "waitTime",
+			expected: float64(30),
+		},
+		{
+			name: "list variable",
+			config: `
+  variables: {regions: [us-east-1, us-west-2]}`,
+			refID:    "bake",
+			key:      "regions",
+			expected: []interface{}{"us-east-1", "us-west-2"},
+		},
+		{
+			name: "replaced stage",
+			config: `
+stages:
+- id: deploy
+  type: wait
+  config: {waitTime: 5}`,
+			refID:    "deploy",
+			key:      "type",
+			expected: "wait",
+		},
+		{
+			name: "merge into a list item",
+			config: `
+stages:
+- id: deploy
+  inheritanceControl:
+    merge:
+    - path: $.clusters[0].capacity
+      value: {desired: 1}`,
+			refID: "deploy",
+			key:   "clusters",
+			expected: []interface{}{map[string]interface{}{
+				"account":  "test",
+				"capacity": map[string]interface{}{"min": float64(1), "max": float64(1), "desired": float64(1)},
+			}},
+		},
+		{
+			name: "merge into a list",
+			config: `
+stages:
+- id: deploy
+  inheritanceControl:
+    merge:
+    - path: clusters
+      value: [{account: prod}]`,
+			refID: "deploy",
+			key:   "clusters",
+			expected: []interface{}{
+				map[string]interface{}{"account": "test", "capacity": map[string]interface{}{"min": float64(1), "max": float64(1)}},
+				map[string]interface{}{"account": "prod"},
+			},
+		},
+		{
+			name: "replace",
+			config: `
+stages:
+- id: deploy
+  inheritanceControl:
+    replace:
+    - path: $.clusters[0].capacity
+      value: {min: "{{ waitTime }}"}`,
+			refID: "deploy",
+			key:   "clusters",
+			expected: []interface{}{map[string]interface{}{
+				"account":  "test",
+				"capacity": map[string]interface{}{"min": float64(10)},
+			}},
+		},
+		{
+			name: "remove",
+			config: `
+stages:
+- id: deploy
+  inheritanceControl:
+    remove:
+    - path: $.clusters[0].capacity`,
+			refID:    "deploy",
+			key:      "clusters",
+			expected: []interface{}{map[string]interface{}{"account": "test"}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pipeline, err := renderTestPipeline(t, testTemplate, testConfig(c.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			stage := renderedStage(pipeline, c.refID)
+			if stage == nil {
+				t.Fatalf("stage %s was not rendered: %v", c.refID, stageGraph(pipeline))
+			}
+			if !reflect.DeepEqual(stage[c.key], c.expected) {
+				t.Errorf("expected %s of %s to be %#v, got %#v", c.key, c.refID, c.expected, stage[c.key])
+			}
+		})
+	}
+}
+
+func TestRenderPipelineConfiguration(t *testing.T) {
+	template := testTemplate + `
+configuration:
+  concurrentExecutions: {limitConcurrent: false}
+  triggers:
+  - type: cron
+    cronExpression: "{{ waitTime }}"
+  parameters:
+  - name: template
+`
+	pipeline, err := renderTestPipeline(t, template, `
+schema: "1"
+pipeline:
+  application: app
+  name: test
+  pipelineConfigId: abc
+configuration:
+  inherit: [concurrentExecutions, triggers]
+  parameters:
+  - name: config
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"application":          "app",
+		"name":                 "test",
+		"id":                   "abc",
+		"limitConcurrent":      false,
+		"keepWaitingPipelines": false,
+		"triggers":             []interface{}{map[string]interface{}{"type": "cron", "cronExpression": float64(10)}},
+		"parameterConfig":      []interface{}{map[string]interface{}{"name": "config"}},
+		"notifications":        []interface{}{},
+		"expectedArtifacts":    []interface{}{},
+	}
+	delete(pipeline, "stages")
+	if !reflect.DeepEqual(pipeline, expected) {
+		t.Errorf("expected %#v, got %#v", expected, pipeline)
+	}
+}
+
+func TestRenderPipelineErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		config   string
+		location string
+		err      string
+	}{
+		{
+			name:   "missing application",
+			config: `{schema: "1"}`,
+			// Orca reports configuration errors by location.
+			location: "configuration:application",
+			err:      "Missing 'application' configuration",
+		},
+		{
+			name:     "unsupported schema",
+			config:   `{schema: "2", pipeline: {application: app}}`,
+			location: "configuration:schema",
+			err:      "schema version is unsupported",
+		},
+		{
+			name: "unset stage config",
+			config: `
+schema: "1"
+pipeline: {application: app}
+stages:
+- id: extra
+  type: wait
+  dependsOn: [bake]`,
+			location: "configuration:stages.extra",
+			err:      "Stage configuration is unset",
+		},
+		{
+			name: "dependsOn and inject",
+			config: `
+schema: "1"
+pipeline: {application: app}
+stages:
+- id: extra
+  type: wait
+  dependsOn: [bake]
+  inject: {first: true}
+  config: {}`,
+			location: "configuration:stages.extra",
+			err:      "cannot have both dependsOn and an inject rule",
+		},
+		{
+			name: "missing variable",
+			template: `
+schema: "1"
+variables:
+- name: required
+stages: []`,
+			config:   `{schema: "1", pipeline: {application: app}}`,
+			location: "configuration:pipeline.variables",
+			err:      "required",
+		},
+		{
+			name: "undefined variable in a stage",
+			template: `
+schema: "1"
+stages:
+- id: wait
+  type: wait
+  config: {waitTime: "{{ nope }}"}`,
+			config:   `{schema: "1", pipeline: {application: app}}`,
+			location: "template:stages.wait",
+			err:      "undefined variable nope",
+		},
+		{
+			name: "undefined variable in a partial",
+			template: `
+schema: "1"
+stages:
+- id: p
+  type: partial.p
+  config: {}
+partials:
+- id: p
+  stages:
+  - id: wait
+    type: wait
+    config: {waitTime: "{{ nope }}"}`,
+			config:   `{schema: "1", pipeline: {application: app}}`,
+			location: "template:partials.p.stages.wait",
+			err:      "undefined variable nope",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			template := c.template
+			if template == "" {
+				template = testTemplate
+			}
+			_, err := renderTestPipeline(t, template, c.config)
+			invalid, ok := err.(*templateInvalidError)
+			if !ok {
+				t.Fatalf("expected a *templateInvalidError, got %v", err)
+			}
+			for _, planErr := range invalid.resp.Errors {
+				if planErr.Severity == severityFatal && planErr.Location == c.location &&
+					strings.Contains(planErr.Message+" "+planErr.Cause, c.err) {
+					return
+				}
+			}
+			t.Errorf("expected a fatal error at %s containing %q, got %v", c.location, c.err, err)
+		})
+	}
+}
+
+func TestRenderPipelineGraphErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{
+			name: "unknown dependency",
+			config: `
+- id: extra
+  type: wait
+  dependsOn: [nope]
+  config: {}`,
+			err: "depends on unknown stage nope",
+		},
+		{
+			name: "cycle",
+			config: `
+- id: bake
+  type: bake
+  dependsOn: [deploy]
+  config: {}`,
+			err: "stage dependency cycle",
+		},
+		{
+			name: "inject relative to unknown stage",
+			config: `
+- id: extra
+  type: wait
+  inject: {after: [nope]}
+  config: {}`,
+			err: "injected relative to unknown stage nope",
+		},
+		{
+			name: "inheritance control path through a scalar",
+			config: `
+- id: deploy
+  inheritanceControl:
+    merge:
+    - path: $.clusters[0].account.x
+      value: 1`,
+			err: "is not an object",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := renderTestPipeline(t, testTemplate, `
+schema: "1"
+pipeline: {application: app}
+stages:`+c.config)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("expected an error containing %q, got %v", c.err, err)
+			}
+		})
+	}
+}
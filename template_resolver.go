@@ -0,0 +1,349 @@
+package roer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// templateResolver loads pipeline templates from the source URIs that
+// configurations and child templates refer to them by. file:// URIs and plain
+// paths are local files, relative to the file referring to them. spinnaker://
+// URIs are looked up by template id among the substituted templates, then in
+// the --template-path directories, or else fetched from Spinnaker if the
+// resolver has a client.
+type templateResolver struct {
+	paths       []string
+	client      spinnaker.Client
+	index       map[string]string
+	substitutes map[string]map[string]interface{}
+}
+
+// newTemplateResolver creates a resolver. Without a client, templates are only
+// resolved from local files.
+func newTemplateResolver(paths []string, client spinnaker.Client) *templateResolver {
+	return &templateResolver{paths: paths, client: client}
+}
+
+// substitute makes spinnaker:// sources referring to a template id resolve to
+// the given template, such as a local version of a template about to be
+// published.
+func (r *templateResolver) substitute(id string, template map[string]interface{}) {
+	if r.substitutes == nil {
+		r.substitutes = map[string]map[string]interface{}{}
+	}
+	r.substitutes[id] = template
+}
+
+// isLocalSource reports whether a source refers to a local file.
+func isLocalSource(source string) bool {
+	return source != "" && (strings.HasPrefix(source, "file://") || !strings.Contains(source, "://"))
+}
+
+// resolvesLocally reports whether a source can be resolved without Spinnaker.
+func (r *templateResolver) resolvesLocally(source string) (bool, error) {
+	if isLocalSource(source) {
+		return true, nil
+	}
+	if !strings.HasPrefix(source, "spinnaker://") {
+		return false, nil
+	}
+	id := strings.TrimPrefix(source, "spinnaker://")
+	if _, ok := r.substitutes[id]; ok {
+		return true, nil
+	}
+	index, err := r.templateIndex()
+	if err != nil {
+		return false, err
+	}
+	_, ok := index[id]
+	return ok, nil
+}
+
+// load returns the template a source refers to, and where it was loaded from:
+// the absolute path of a local file, or the source for templates fetched from
+// Spinnaker. Relative paths are relative to baseDir.
+func (r *templateResolver) load(source, baseDir string) (map[string]interface{}, string, error) {
+	if isLocalSource(source) {
+		path := strings.TrimPrefix(source, "file://")
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		return r.loadFile(path)
+	}
+
+	if !strings.HasPrefix(source, "spinnaker://") {
+		return nil, "", fmt.Errorf("unsupported template source %q", source)
+	}
+	id := strings.TrimPrefix(source, "spinnaker://")
+	if template, ok := r.substitutes[id]; ok {
+		return template, source, nil
+	}
+	index, err := r.templateIndex()
+	if err != nil {
+		return nil, "", err
+	}
+	if path, ok := index[id]; ok {
+		return r.loadFile(path)
+	}
+	if r.client == nil {
+		return nil, "", fmt.Errorf("template %s is not in the template path", id)
+	}
+
+	logrus.WithField("source", source).Debug("Fetching template")
+	template, err := r.client.GetTemplate(id)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "fetching template %s", id)
+	}
+	if template == nil {
+		return nil, "", notFound("could not find pipeline template %s", id)
+	}
+	return template, source, nil
+}
+
+func (r *templateResolver) loadFile(path string) (map[string]interface{}, string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+	logrus.WithField("file", abs).Debug("Reading template")
+	template, err := readYamlFile(abs)
+	if err != nil {
+		return nil, "", err
+	}
+	return template, abs, nil
+}
+
+// resolve walks the source chain of a template loaded from location and
+// returns the fully merged template, along with the locations of the chain
+// from the given template up to the root.
+func (r *templateResolver) resolve(template map[string]interface{}, location string) (map[string]interface{}, []string, error) {
+	chain := []map[string]interface{}{template}
+	locations := []string{location}
+	seen := map[string]bool{location: true}
+
+	for {
+		source, _ := template["source"].(string)
+		if source == "" {
+			break
+		}
+		baseDir := ""
+		if filepath.IsAbs(location) {
+			baseDir = filepath.Dir(location)
+		} else if isLocalSource(source) && !filepath.IsAbs(strings.TrimPrefix(source, "file://")) {
+			return nil, nil, fmt.Errorf("cannot resolve relative source %q of %s", source, location)
+		}
+
+		parent, parentLocation, err := r.load(source, baseDir)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "resolving source %s of %s", source, location)
+		}
+		if seen[parentLocation] {
+			return nil, nil, fmt.Errorf("template source cycle: %s", strings.Join(append(locations, parentLocation), " -> "))
+		}
+		seen[parentLocation] = true
+		chain = append(chain, parent)
+		locations = append(locations, parentLocation)
+		template, location = parent, parentLocation
+	}
+
+	merged := chain[len(chain)-1]
+	for i := len(chain) - 2; i >= 0; i-- {
+		merged = mergeTemplates(merged, chain[i])
+	}
+	delete(merged, "source")
+	return merged, locations, nil
+}
+
+// resolveFile loads and resolves the template in a local file.
+func (r *templateResolver) resolveFile(path string) (map[string]interface{}, []string, error) {
+	template, location, err := r.loadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.resolve(template, location)
+}
+
+// templateIndex maps template ids to the files in the template path defining
+// them. It is built on first use.
+func (r *templateResolver) templateIndex() (map[string]string, error) {
+	if r.index != nil {
+		return r.index, nil
+	}
+	index := map[string]string{}
+	for _, dir := range r.paths {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			switch filepath.Ext(path) {
+			case ".yml", ".yaml", ".json":
+			default:
+				return nil
+			}
+			m, err := readYamlFile(path)
+			if err != nil {
+				logrus.WithError(err).WithField("file", path).Debug("Skipping unreadable file in template path")
+				return nil
+			}
+			if !isPipelineTemplate(m) {
+				return nil
+			}
+			id := m["id"].(string)
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			if existing, ok := index[id]; ok && existing != abs {
+				return fmt.Errorf("template %s is defined in both %s and %s", id, existing, abs)
+			}
+			index[id] = abs
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "indexing template path %s", dir)
+		}
+	}
+	r.index = index
+	return index, nil
+}
+
+// mergeTemplates merges a child template into its parent, as Orca does when
+// resolving a source chain. Stages, modules and partials are merged by id,
+// variables and configuration entries by name; a child entry replaces the
+// parent's entry of the same id or name. Any other child value replaces the
+// parent's.
+func mergeTemplates(parent, child map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range child {
+		switch k {
+		case "stages", "modules", "partials":
+			merged[k] = mergeNamedList(parent[k], v, "id")
+		case "variables":
+			merged[k] = mergeNamedList(parent[k], v, "name")
+		case "configuration":
+			merged[k] = mergeConfiguration(parent[k], v)
+		default:
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func mergeConfiguration(parent, child interface{}) interface{} {
+	p, ok := parent.(map[string]interface{})
+	if !ok {
+		return child
+	}
+	c, ok := child.(map[string]interface{})
+	if !ok {
+		return child
+	}
+	merged := map[string]interface{}{}
+	for k, v := range p {
+		merged[k] = v
+	}
+	for k, v := range c {
+		switch k {
+		case "triggers", "parameters", "notifications", "expectedArtifacts":
+			merged[k] = mergeNamedList(p[k], v, "name")
+		case "concurrentExecutions":
+			ce := map[string]interface{}{}
+			if pce, ok := p[k].(map[string]interface{}); ok {
+				for key, value := range pce {
+					ce[key] = value
+				}
+			}
+			if cce, ok := v.(map[string]interface{}); ok {
+				for key, value := range cce {
+					ce[key] = value
+				}
+			}
+			merged[k] = ce
+		default:
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// mergeNamedList merges two lists of objects by the given key, keeping the
+// parent's order and appending new child entries.
+func mergeNamedList(parent, child interface{}, key string) interface{} {
+	p, ok := parent.([]interface{})
+	if !ok {
+		return child
+	}
+	c, ok := child.([]interface{})
+	if !ok {
+		return child
+	}
+
+	merged := append([]interface{}{}, p...)
+	positions := map[interface{}]int{}
+	for i, item := range merged {
+		if m, ok := item.(map[string]interface{}); ok && m[key] != nil {
+			positions[m[key]] = i
+		}
+	}
+	for _, item := range c {
+		if m, ok := item.(map[string]interface{}); ok && m[key] != nil {
+			if i, ok := positions[m[key]]; ok {
+				merged[i] = item
+				continue
+			}
+		}
+		merged = append(merged, item)
+	}
+	return merged
+}
+
+// configurationSource returns the template source of a pipeline configuration.
+func configurationSource(config map[string]interface{}) string {
+	pipeline, _ := config["pipeline"].(map[string]interface{})
+	template, _ := pipeline["template"].(map[string]interface{})
+	source, _ := template["source"].(string)
+	return source
+}
+
+// configurationTemplate resolves the template of a pipeline configuration
+// from local files: the template file if one is given, otherwise the source
+// of the configuration if it resolves locally. It returns a nil template when
+// the template can only be resolved by Spinnaker, and otherwise the location
+// of the file the chain started from.
+func configurationTemplate(resolver *templateResolver, configFile string, config map[string]interface{}, templateFile string) (map[string]interface{}, string, error) {
+	var template map[string]interface{}
+	var location string
+	var err error
+	if templateFile != "" {
+		template, location, err = resolver.loadFile(templateFile)
+	} else {
+		source := configurationSource(config)
+		var local bool
+		if local, err = resolver.resolvesLocally(source); err != nil || !local {
+			return nil, "", err
+		}
+		template, location, err = resolver.load(source, filepath.Dir(configFile))
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	merged, chain, err := resolver.resolve(template, location)
+	if err != nil {
+		return nil, "", err
+	}
+	logrus.WithField("chain", strings.Join(chain, " -> ")).Debug("Resolved template")
+	return merged, location, nil
+}
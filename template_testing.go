@@ -0,0 +1,337 @@
+package roer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// Template test cases are configurations named *.config.yml, paired with a
+// golden file next to them: *.expected.json holds the expected pipeline, and
+// *.errors.json the expected plan errors.
+const (
+	testConfigSuffix   = ".config.yml"
+	testExpectedSuffix = ".expected.json"
+	testErrorsSuffix   = ".errors.json"
+)
+
+// Sources of plan errors, recorded in *.errors.json golden files. Errors found
+// by roer, when rendering offline or checking variables, are worded
+// differently from Orca's, so errors from different sources are only compared
+// by severity and location.
+const (
+	errorSourceRoer = "roer"
+	errorSourceOrca = "orca"
+)
+
+// templateTestCase is a pipeline configuration and its golden files.
+type templateTestCase struct {
+	name       string
+	configFile string
+	base       string
+}
+
+func (c templateTestCase) expectedFile() string {
+	return c.base + testExpectedSuffix
+}
+
+func (c templateTestCase) errorsFile() string {
+	return c.base + testErrorsSuffix
+}
+
+// discoverTemplateTests finds the test cases in a directory tree.
+func discoverTemplateTests(dir string) ([]templateTestCase, error) {
+	cases := []templateTestCase{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, suffix := range []string{testConfigSuffix, ".config.yaml"} {
+			if !info.IsDir() && strings.HasSuffix(path, suffix) {
+				name, err := filepath.Rel(dir, path)
+				if err != nil {
+					return err
+				}
+				cases = append(cases, templateTestCase{
+					name:       strings.TrimSuffix(name, suffix),
+					configFile: path,
+					base:       strings.TrimSuffix(path, suffix),
+				})
+			}
+		}
+		return nil
+	})
+	sort.Slice(cases, func(i, j int) bool {
+		return cases[i].name < cases[j].name
+	})
+	return cases, err
+}
+
+// planOutcome is the normalized result of planning a configuration: either
+// the planned pipeline or the plan errors, as indented JSON with sorted keys.
+type planOutcome struct {
+	failed bool
+	body   string
+}
+
+func (o planOutcome) describe() string {
+	if o.failed {
+		return "plan errors"
+	}
+	return "a pipeline"
+}
+
+// templatePlanner plans a test case configuration.
+type templatePlanner func(configFile string, config map[string]interface{}) (planOutcome, error)
+
+// offlinePlanner renders configurations locally. Validation and rendering
+// errors are recorded in the shape of Orca's plan errors.
+func offlinePlanner(resolver *templateResolver) templatePlanner {
+	return func(configFile string, configMap map[string]interface{}) (planOutcome, error) {
+		templateMap, _, err := configurationTemplate(resolver, configFile, configMap, "")
+		if err != nil {
+			return planOutcome{}, errors.Wrap(err, "resolving pipeline template")
+		}
+		if templateMap == nil {
+			return planOutcome{}, fmt.Errorf("template source %q is not local or in the template path", configurationSource(configMap))
+		}
+
+		var config PipelineConfiguration
+		if err := convertMap(configMap, &config); err != nil {
+			return planOutcome{}, errors.Wrap(err, "decoding pipeline configuration")
+		}
+		var template PipelineTemplate
+		if err := convertMap(templateMap, &template); err != nil {
+			return planOutcome{}, errors.Wrap(err, "decoding pipeline template")
+		}
+
+		pipeline, renderErr := renderPipeline(config, template)
+		if renderErr != nil {
+			resp := &spinnaker.TemplatedPipelineErrorResponse{
+				Message: "Pipeline template is invalid",
+				Errors: []spinnaker.TemplatedPipelineError{
+					{Severity: severityFatal, Message: renderErr.Error()},
+				},
+			}
+			if invalid, ok := renderErr.(*templateInvalidError); ok {
+				resp = invalid.resp
+			}
+			dat, err := json.Marshal(resp)
+			if err != nil {
+				return planOutcome{}, err
+			}
+			return errorOutcome(dat, errorSourceRoer)
+		}
+		dat, err := json.Marshal(pipeline)
+		if err != nil {
+			return planOutcome{}, err
+		}
+		body, err := normalizePlan(dat)
+		return planOutcome{body: body}, err
+	}
+}
+
+// onlinePlanner plans configurations through Spinnaker, inlining the template
+// when it resolves locally.
+func onlinePlanner(client spinnaker.Client, resolver *templateResolver) templatePlanner {
+	return func(configFile string, config map[string]interface{}) (planOutcome, error) {
+		template, _, err := configurationTemplate(resolver, configFile, config, "")
+		if err != nil {
+			return planOutcome{}, errors.Wrap(err, "resolving pipeline template")
+		}
+
+		checked := template
+		if checked == nil {
+			checked = publishedConfigurationTemplate(resolver, config)
+		}
+		if checked != nil {
+			if outcome, failed, err := variableOutcome(checked, config); failed || err != nil {
+				return outcome, err
+			}
+		}
+
+		resp, err := client.Plan(config, template)
+		if err == spinnaker.ErrInvalidPipelineTemplate {
+			outcome, err := errorOutcome(resp, errorSourceOrca)
+			if err != nil {
+				return planOutcome{}, errors.Wrap(err, "decoding plan errors")
+			}
+			return outcome, nil
+		}
+		if err != nil {
+			return planOutcome{}, errors.Wrap(err, "planning configuration")
+		}
+		body, err := normalizePlan(resp)
+		return planOutcome{body: body}, err
+	}
+}
+
+// variableOutcome checks the variables of a configuration the way plan does,
+// returning the plan errors as the outcome if the check fails.
+func variableOutcome(template, config map[string]interface{}) (planOutcome, bool, error) {
+	resp, err := checkConfigurationVariables(template, config)
+	if err != nil || resp == nil || !planFailed(resp, "fatal") {
+		return planOutcome{}, false, err
+	}
+	dat, err := json.Marshal(resp)
+	if err != nil {
+		return planOutcome{}, false, err
+	}
+	outcome, err := errorOutcome(dat, errorSourceRoer)
+	return outcome, true, err
+}
+
+// errorOutcome records plan errors as a failed outcome, along with their
+// source.
+func errorOutcome(dat []byte, source string) (planOutcome, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(dat, &m); err != nil {
+		return planOutcome{}, err
+	}
+	m["source"] = source
+	body, err := canonicalJSON(m)
+	return planOutcome{failed: true, body: body}, err
+}
+
+// errorSource returns the source recorded with plan errors.
+func errorSource(v interface{}) string {
+	m, _ := v.(map[string]interface{})
+	source, _ := m["source"].(string)
+	return source
+}
+
+// errorLocations reduces plan errors to their severities and locations,
+// including those of nested errors, in a stable order.
+func errorLocations(v interface{}) []interface{} {
+	locations := []string{}
+	var walk func(errs interface{})
+	walk = func(errs interface{}) {
+		list, _ := errs.([]interface{})
+		for _, e := range list {
+			m, _ := e.(map[string]interface{})
+			severity, _ := m["severity"].(string)
+			location, _ := m["location"].(string)
+			locations = append(locations, strings.TrimSpace(severity+" "+location))
+			walk(m["nestedErrors"])
+		}
+	}
+	m, _ := v.(map[string]interface{})
+	walk(m["errors"])
+	sort.Strings(locations)
+
+	out := make([]interface{}, len(locations))
+	for i, l := range locations {
+		out[i] = l
+	}
+	return out
+}
+
+// templateTestResult is the outcome of running a test case.
+type templateTestResult struct {
+	passed  bool
+	updated bool
+	message string
+	diff    string
+}
+
+// runTemplateTest plans a test case and compares it with its golden file, or
+// rewrites the golden file when update is set.
+func runTemplateTest(c templateTestCase, plan templatePlanner, update bool) templateTestResult {
+	config, err := readYamlFile(c.configFile)
+	if err != nil {
+		return templateTestResult{message: err.Error()}
+	}
+	actual, err := plan(c.configFile, config)
+	if err != nil {
+		return templateTestResult{message: err.Error()}
+	}
+
+	golden, stale := c.expectedFile(), c.errorsFile()
+	if actual.failed {
+		golden, stale = stale, golden
+	}
+
+	if update {
+		existing, err := ioutil.ReadFile(golden)
+		if err == nil && string(existing) == actual.body && !fileExists(stale) {
+			return templateTestResult{passed: true}
+		}
+		if err := ioutil.WriteFile(golden, []byte(actual.body), 0644); err != nil {
+			return templateTestResult{message: err.Error()}
+		}
+		if fileExists(stale) {
+			if err := os.Remove(stale); err != nil {
+				return templateTestResult{message: err.Error()}
+			}
+		}
+		return templateTestResult{passed: true, updated: true, message: "wrote " + golden}
+	}
+
+	expectedFile := c.expectedFile()
+	expected := planOutcome{}
+	if !fileExists(expectedFile) {
+		expectedFile = c.errorsFile()
+		expected.failed = true
+	}
+	dat, err := ioutil.ReadFile(expectedFile)
+	if os.IsNotExist(err) {
+		return templateTestResult{message: fmt.Sprintf("no golden file, expected %s or %s (run with --update to create it)", c.expectedFile(), c.errorsFile())}
+	}
+	if err != nil {
+		return templateTestResult{message: err.Error()}
+	}
+	var expectedValue interface{}
+	if err := json.Unmarshal(dat, &expectedValue); err != nil {
+		return templateTestResult{message: fmt.Sprintf("decoding %s: %v", expectedFile, err)}
+	}
+	if expected.body, err = canonicalJSON(expectedValue); err != nil {
+		return templateTestResult{message: err.Error()}
+	}
+
+	if expected.failed != actual.failed {
+		return templateTestResult{
+			message: fmt.Sprintf("expected %s, got %s", expected.describe(), actual.describe()),
+			diff:    indentLines(actual.body, "    "),
+		}
+	}
+
+	var actualValue interface{}
+	if err := json.Unmarshal([]byte(actual.body), &actualValue); err != nil {
+		return templateTestResult{message: err.Error()}
+	}
+	message := "does not match " + expectedFile
+	if from, to := errorSource(expectedValue), errorSource(actualValue); expected.failed && from != to {
+		message += fmt.Sprintf(" by severity and location, since the errors come from %s and the golden errors from %s", to, from)
+		expectedValue, actualValue = errorLocations(expectedValue), errorLocations(actualValue)
+		if expected.body, err = canonicalJSON(expectedValue); err != nil {
+			return templateTestResult{message: err.Error()}
+		}
+		if actual.body, err = canonicalJSON(actualValue); err != nil {
+			return templateTestResult{message: err.Error()}
+		}
+	}
+	if expected.body == actual.body {
+		return templateTestResult{passed: true}
+	}
+	return templateTestResult{
+		message: message,
+		diff:    formatChanges(diffValues("", expectedValue, actualValue), "    "),
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func indentLines(s, indent string) string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	return indent + strings.Join(lines, "\n"+indent) + "\n"
+}
@@ -0,0 +1,184 @@
+package roer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// supportedTemplateSchema is the only MPT schema version Orca plans.
+const supportedTemplateSchema = "1"
+
+// templateInvalidError is returned by renderPipeline for configurations Orca
+// would refuse to plan. It carries the plan errors Orca would respond with.
+type templateInvalidError struct {
+	resp *spinnaker.TemplatedPipelineErrorResponse
+}
+
+func (e *templateInvalidError) Error() string {
+	messages := []string{}
+	for _, planErr := range e.resp.Errors {
+		if planErr.Severity != severityFatal {
+			continue
+		}
+		message := planErr.Message
+		if planErr.Location != "" {
+			message = planErr.Location + ": " + message
+		}
+		if planErr.Cause != "" {
+			message += " (" + planErr.Cause + ")"
+		}
+		messages = append(messages, message)
+	}
+	return fmt.Sprintf("%s: %s", e.resp.Message, strings.Join(messages, "; "))
+}
+
+// renderFailure reports a stage that cannot be rendered, such as one using an
+// undefined variable, the way Orca reports its Jinja render errors.
+func renderFailure(location string, err error) *templateInvalidError {
+	return &templateInvalidError{resp: &spinnaker.TemplatedPipelineErrorResponse{
+		Message: "Pipeline template is invalid",
+		Errors: []spinnaker.TemplatedPipelineError{{
+			Severity: severityFatal,
+			Location: location,
+			Message:  "Failed rendering jinja template",
+			Cause:    err.Error(),
+		}},
+	}}
+}
+
+// checkPipelineTemplate validates a template and configuration the way Orca's
+// MPT v1 schema validators do before planning, along with the configuration's
+// variables. It returns nil if there is nothing to report.
+func checkPipelineTemplate(template PipelineTemplate, config PipelineConfiguration) *spinnaker.TemplatedPipelineErrorResponse {
+	planErrors := append(validateTemplateSchema(template), validateConfigurationSchema(template, config)...)
+	if resp := checkVariables(template, config); resp != nil {
+		planErrors = append(planErrors, resp.Errors...)
+	}
+	if len(planErrors) == 0 {
+		return nil
+	}
+	return &spinnaker.TemplatedPipelineErrorResponse{
+		Message: "Pipeline template is invalid",
+		Errors:  planErrors,
+	}
+}
+
+// validateTemplateSchema checks the schema version and stages of a template.
+func validateTemplateSchema(template PipelineTemplate) []spinnaker.TemplatedPipelineError {
+	planErrors := []spinnaker.TemplatedPipelineError{}
+	if template.Schema != supportedTemplateSchema {
+		planErrors = append(planErrors, unsupportedSchemaError("template", template.Schema))
+	}
+	for _, s := range template.Stages {
+		planErrors = append(planErrors, validateStage("template:stages", s, true)...)
+	}
+	for _, p := range template.Partials {
+		for _, s := range p.Stages {
+			planErrors = append(planErrors, validateStage("template:partials."+p.ID+".stages", s, true)...)
+		}
+	}
+	return planErrors
+}
+
+// validateConfigurationSchema checks the schema version, application and
+// stages of a configuration. Configuration stages with the id of a template
+// stage replace or modify it, so they may leave out their type and placement.
+func validateConfigurationSchema(template PipelineTemplate, config PipelineConfiguration) []spinnaker.TemplatedPipelineError {
+	planErrors := []spinnaker.TemplatedPipelineError{}
+	if config.Schema != supportedTemplateSchema {
+		planErrors = append(planErrors, unsupportedSchemaError("configuration", config.Schema))
+	}
+	if config.Pipeline.Application == "" {
+		planErrors = append(planErrors, spinnaker.TemplatedPipelineError{
+			Severity: severityFatal,
+			Location: "configuration:application",
+			Message:  "Missing 'application' configuration",
+		})
+	}
+	if template.Protect && len(config.Stages) > 0 {
+		planErrors = append(planErrors, spinnaker.TemplatedPipelineError{
+			Severity: severityFatal,
+			Location: "configuration:stages",
+			Message:  "Modification of the stage graph (adding, removing, editing) is disallowed",
+		})
+	}
+
+	templateStages := map[string]bool{}
+	for _, s := range template.Stages {
+		templateStages[s.ID] = true
+	}
+	for _, s := range config.Stages {
+		overrides := templateStages[s.ID]
+		if overrides && s.Type == "" {
+			continue
+		}
+		planErrors = append(planErrors, validateStage("configuration:stages", s, !overrides)...)
+		if !overrides && s.ID != "" && len(s.DependsOn) == 0 && !stageInjected(s) {
+			planErrors = append(planErrors, spinnaker.TemplatedPipelineError{
+				Severity: severityWarn,
+				Location: "configuration:stages." + s.ID,
+				Message:  "A configuration-defined stage should have either dependsOn or an inject rule defined",
+			})
+		}
+	}
+	for _, p := range config.Partials {
+		for _, s := range p.Stages {
+			planErrors = append(planErrors, validateStage("configuration:partials."+p.ID+".stages", s, true)...)
+		}
+	}
+	return planErrors
+}
+
+// validateStage checks that a stage has an id, a type when required, a config
+// and at most one way of placing it in the graph.
+func validateStage(location string, s PipelineTemplateStage, requireType bool) []spinnaker.TemplatedPipelineError {
+	if s.ID == "" {
+		return []spinnaker.TemplatedPipelineError{{
+			Severity: severityFatal,
+			Location: location,
+			Message:  "Stage ID is unset",
+		}}
+	}
+	location += "." + s.ID
+	planErrors := []spinnaker.TemplatedPipelineError{}
+	fatal := func(message string) {
+		planErrors = append(planErrors, spinnaker.TemplatedPipelineError{
+			Severity: severityFatal,
+			Location: location,
+			Message:  message,
+		})
+	}
+	if requireType && s.Type == "" {
+		fatal("Stage is missing type")
+	}
+	if s.Config == nil {
+		fatal("Stage configuration is unset")
+	}
+	if len(s.DependsOn) > 0 && stageInjected(s) {
+		fatal("A stage cannot have both dependsOn and an inject rule defined simultaneously")
+	}
+	rules := 0
+	for _, set := range []bool{s.Inject.First, s.Inject.Last, len(s.Inject.Before) > 0, len(s.Inject.After) > 0} {
+		if set {
+			rules++
+		}
+	}
+	if rules > 1 {
+		fatal("A stage cannot have multiple inject rules defined")
+	}
+	return planErrors
+}
+
+func stageInjected(s PipelineTemplateStage) bool {
+	return s.Inject.First || s.Inject.Last || len(s.Inject.Before) > 0 || len(s.Inject.After) > 0
+}
+
+func unsupportedSchemaError(kind, schema string) spinnaker.TemplatedPipelineError {
+	return spinnaker.TemplatedPipelineError{
+		Severity: severityFatal,
+		Location: kind + ":schema",
+		Message:  fmt.Sprintf("%s schema version is unsupported, expected '%s', got '%s'", strings.Title(kind), supportedTemplateSchema, schema),
+	}
+}
@@ -0,0 +1,235 @@
+package roer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spinnaker/roer/spinnaker"
+)
+
+// Variable types, as declared by templates. Variables without a type are
+// objects, which accept any value.
+const (
+	variableString  = "string"
+	variableInt     = "int"
+	variableFloat   = "float"
+	variableBoolean = "boolean"
+	variableList    = "list"
+	variableObject  = "object"
+)
+
+// variableType returns the declared type of a variable.
+func variableType(v PipelineTemplateVariable) string {
+	if v.Type == "" {
+		return variableObject
+	}
+	return v.Type
+}
+
+// checkVariables validates the variables of a pipeline configuration against
+// the variables declared by its template, the way Orca would when planning.
+// Missing required variables and type mismatches are fatal, unknown variables
+// are warnings since Orca ignores them. It returns nil if there is nothing to
+// report.
+func checkVariables(template PipelineTemplate, config PipelineConfiguration) *spinnaker.TemplatedPipelineErrorResponse {
+	values := config.Pipeline.Variables
+	planErrors := []spinnaker.TemplatedPipelineError{}
+	declared := map[string]bool{}
+
+	for _, v := range template.Variables {
+		declared[v.Name] = true
+		typ := variableType(v)
+		switch typ {
+		case variableString, variableInt, variableFloat, variableBoolean, variableList, variableObject:
+		default:
+			planErrors = append(planErrors, spinnaker.TemplatedPipelineError{
+				Severity:   severityFatal,
+				Location:   "template:variables." + v.Name,
+				Message:    fmt.Sprintf("Variable %s has unknown type %s", v.Name, typ),
+				Suggestion: "Use one of string, int, float, boolean, list or object",
+			})
+			continue
+		}
+
+		value, ok := values[v.Name]
+		if !ok {
+			if v.DefaultValue == nil && !v.Nullable {
+				planErrors = append(planErrors, spinnaker.TemplatedPipelineError{
+					Severity:   severityFatal,
+					Location:   "configuration:pipeline.variables",
+					Message:    fmt.Sprintf("Missing value for required variable %s", v.Name),
+					Suggestion: variableSuggestion(v),
+					Detail:     map[string]string{"variable": v.Name, "type": typ},
+				})
+			}
+			continue
+		}
+		if value == nil {
+			if !v.Nullable {
+				planErrors = append(planErrors, spinnaker.TemplatedPipelineError{
+					Severity:   severityFatal,
+					Location:   "configuration:pipeline.variables." + v.Name,
+					Message:    fmt.Sprintf("Variable %s is null, but is not nullable", v.Name),
+					Suggestion: variableSuggestion(v),
+				})
+			}
+			continue
+		}
+		if !variableValueMatches(typ, value) {
+			planErrors = append(planErrors, spinnaker.TemplatedPipelineError{
+				Severity:   severityFatal,
+				Location:   "configuration:pipeline.variables." + v.Name,
+				Message:    fmt.Sprintf("Variable %s must be of type %s, got %s", v.Name, typ, valueKind(value)),
+				Suggestion: variableSuggestion(v),
+				Detail:     map[string]string{"expected": typ, "actual": valueKind(value)},
+			})
+		}
+	}
+
+	unknown := []string{}
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		e := spinnaker.TemplatedPipelineError{
+			Severity: severityWarn,
+			Location: "configuration:pipeline.variables." + name,
+			Message:  fmt.Sprintf("Variable %s is not declared by the template and is ignored", name),
+		}
+		if len(template.Variables) > 0 {
+			names := []string{}
+			for _, v := range template.Variables {
+				names = append(names, v.Name)
+			}
+			e.Suggestion = "Declared variables are " + strings.Join(names, ", ")
+		}
+		planErrors = append(planErrors, e)
+	}
+
+	if len(planErrors) == 0 {
+		return nil
+	}
+	return &spinnaker.TemplatedPipelineErrorResponse{
+		Message: "Pipeline configuration variables are invalid",
+		Errors:  planErrors,
+	}
+}
+
+// checkConfigurationVariables decodes a template and configuration and checks
+// the variables of the configuration against the template.
+func checkConfigurationVariables(template, config map[string]interface{}) (*spinnaker.TemplatedPipelineErrorResponse, error) {
+	var t PipelineTemplate
+	if err := convertMap(template, &t); err != nil {
+		return nil, errors.Wrap(err, "decoding pipeline template")
+	}
+	var c PipelineConfiguration
+	if err := convertMap(config, &c); err != nil {
+		return nil, errors.Wrap(err, "decoding pipeline configuration")
+	}
+	return checkVariables(t, c), nil
+}
+
+// validateConfigurationVariables checks the variables of a configuration before
+// it is planned. Failures are printed like plan errors and returned as
+// ErrInvalidPipelineTemplate, other findings are logged as warnings.
+func validateConfigurationVariables(template, config map[string]interface{}, sources *planSources, failOn string) error {
+	resp, err := checkConfigurationVariables(template, config)
+	if err != nil {
+		return err
+	}
+	return reportPlanErrors(resp, sources, failOn)
+}
+
+// publishedConfigurationTemplate fetches and resolves the published template
+// of a configuration, to check the configuration before planning it. Failures
+// are left for Orca to report when planning, so it returns nil on errors.
+func publishedConfigurationTemplate(resolver *templateResolver, config map[string]interface{}) map[string]interface{} {
+	source := configurationSource(config)
+	if !strings.HasPrefix(source, "spinnaker://") {
+		return nil
+	}
+	template, location, err := resolver.load(source, "")
+	if err == nil {
+		template, _, err = resolver.resolve(template, location)
+	}
+	if err != nil {
+		logrus.WithError(err).Debug("Could not fetch template to check variables")
+		return nil
+	}
+	return template
+}
+
+// variableValueMatches reports whether a configuration value has the declared
+// type. Strings with expressions are accepted for any type, since they are
+// only known once rendered.
+func variableValueMatches(typ string, value interface{}) bool {
+	if s, ok := value.(string); ok && strings.Contains(s, "{{") {
+		return true
+	}
+	switch typ {
+	case variableString:
+		_, ok := value.(string)
+		return ok
+	case variableInt:
+		switch n := value.(type) {
+		case int, int64:
+			return true
+		case float64:
+			return n == math.Trunc(n)
+		}
+		return false
+	case variableFloat:
+		switch value.(type) {
+		case int, int64, float64:
+			return true
+		}
+		return false
+	case variableBoolean:
+		_, ok := value.(bool)
+		return ok
+	case variableList:
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return true
+}
+
+// valueKind names the type of a configuration value in template terms.
+func valueKind(value interface{}) string {
+	switch n := value.(type) {
+	case string:
+		return variableString
+	case bool:
+		return variableBoolean
+	case int, int64:
+		return variableInt
+	case float64:
+		if n == math.Trunc(n) {
+			return variableInt
+		}
+		return variableFloat
+	case []interface{}:
+		return variableList
+	case map[string]interface{}:
+		return variableObject
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func variableSuggestion(v PipelineTemplateVariable) string {
+	parts := []string{}
+	if v.Description != "" {
+		parts = append(parts, strings.TrimSpace(v.Description))
+	}
+	if v.Example != nil {
+		parts = append(parts, "Example: "+formatValue(v.Example))
+	}
+	return strings.Join(parts, ". ")
+}